@@ -0,0 +1,314 @@
+package godtemplate
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"regexp"
+	"strings"
+
+	"github.com/beevik/etree"
+	"github.com/boombuler/barcode"
+	"github.com/boombuler/barcode/code128"
+	"github.com/boombuler/barcode/datamatrix"
+	"github.com/boombuler/barcode/ean"
+	"github.com/boombuler/barcode/qr"
+)
+
+// BarcodeFormat is the image format used for generated barcodes.
+type BarcodeFormat string
+
+const (
+	// BarcodeSVG renders barcodes as vector graphics.
+	BarcodeSVG BarcodeFormat = "svg"
+	// BarcodePNG renders barcodes as raster images.
+	BarcodePNG BarcodeFormat = "png"
+)
+
+// barcodePlaceholder matches placeholders like $barcode:code128:DOCUMENTNUMBER
+var barcodePlaceholder = regexp.MustCompile(`\$(?i:barcode):([A-Za-z0-9]+):([A-Za-z0-9_]+)`)
+
+const (
+	// size of a single module for barcodes placed without a surrounding frame
+	barcodeModuleWidthCM  = 0.033
+	barcodeModuleSize2DCM = 0.05
+	barcodeHeight1DCM     = 1.5
+	// pixels per module for raster barcodes
+	barcodePixelsPerModule = 4
+	barcodeHeight1DPixels  = 120
+)
+
+// EncodeBarcode encodes value using the given symbology. Supported kinds are
+// code128, ean13, ean8, datamatrix and qr.
+func EncodeBarcode(kind, value string) (barcode.Barcode, error) {
+	switch strings.ToLower(kind) {
+	case "code128":
+		return code128.Encode(value)
+	case "ean13", "ean":
+		if len(value) != 12 && len(value) != 13 {
+			return nil, fmt.Errorf("ean13 requires 12 or 13 digits, got %q", value)
+		}
+		return ean.Encode(value)
+	case "ean8":
+		if len(value) != 7 && len(value) != 8 {
+			return nil, fmt.Errorf("ean8 requires 7 or 8 digits, got %q", value)
+		}
+		return ean.Encode(value)
+	case "datamatrix":
+		return datamatrix.Encode(value)
+	case "qr", "qrcode":
+		return qr.Encode(value, qr.M, qr.Auto)
+	default:
+		return nil, fmt.Errorf("unsupported barcode type: %s", kind)
+	}
+}
+
+// quietZone returns the number of blank modules around a barcode.
+func quietZone(bc barcode.Barcode) int {
+	switch bc.Metadata().CodeKind {
+	case barcode.TypeCode128:
+		return 10
+	case barcode.TypeEAN8, barcode.TypeEAN13:
+		return 7
+	case barcode.TypeQR:
+		return 4
+	default:
+		return 1
+	}
+}
+
+func isDarkModule(c color.Color) bool {
+	return color.GrayModel.Convert(c).(color.Gray).Y < 128
+}
+
+// BarcodeSVGImage renders a barcode as SVG. One dimensional barcodes are
+// stretched to fill the target frame, two dimensional ones keep their aspect
+// ratio.
+func BarcodeSVGImage(bc barcode.Barcode) []byte {
+	bounds := bc.Bounds()
+	quiet := quietZone(bc)
+	oneDimensional := bc.Metadata().Dimensions == 1
+
+	width := bounds.Dx() + 2*quiet
+	height := bounds.Dy()
+	offsetY := 0
+	aspect := "none"
+	if !oneDimensional {
+		height += 2 * quiet
+		offsetY = quiet
+		aspect = "xMidYMid meet"
+	}
+
+	buf := new(bytes.Buffer)
+	fmt.Fprintf(buf, `<?xml version="1.0" encoding="UTF-8"?>`+"\n")
+	fmt.Fprintf(buf, `<svg xmlns="http://www.w3.org/2000/svg" viewBox="0 0 %d %d" preserveAspectRatio="%s" shape-rendering="crispEdges">`, width, height, aspect)
+	fmt.Fprintf(buf, `<rect width="%d" height="%d" fill="#ffffff"/>`, width, height)
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		// merge adjacent dark modules of a row into a single rectangle
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			if !isDarkModule(bc.At(x, y)) {
+				continue
+			}
+			start := x
+			for x+1 < bounds.Max.X && isDarkModule(bc.At(x+1, y)) {
+				x++
+			}
+			fmt.Fprintf(buf, `<rect x="%d" y="%d" width="%d" height="1" fill="#000000"/>`,
+				start-bounds.Min.X+quiet, y-bounds.Min.Y+offsetY, x-start+1)
+		}
+	}
+	buf.WriteString(`</svg>`)
+	return buf.Bytes()
+}
+
+// BarcodePNGImage renders a barcode as PNG including its quiet zone.
+func BarcodePNGImage(bc barcode.Barcode) ([]byte, error) {
+	bounds := bc.Bounds()
+	quiet := quietZone(bc)
+	scale := barcodePixelsPerModule
+
+	width := (bounds.Dx() + 2*quiet) * scale
+	height := (bounds.Dy() + 2*quiet) * scale
+	if bc.Metadata().Dimensions == 1 {
+		height = barcodeHeight1DPixels
+	}
+
+	img := image.NewGray(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			mx := x/scale - quiet + bounds.Min.X
+			my := y/scale - quiet + bounds.Min.Y
+			if bc.Metadata().Dimensions == 1 {
+				my = bounds.Min.Y
+			}
+			dark := image.Pt(mx, my).In(bounds) && isDarkModule(bc.At(mx, my))
+			if dark {
+				img.SetGray(x, y, color.Gray{Y: 0})
+			} else {
+				img.SetGray(x, y, color.Gray{Y: 255})
+			}
+		}
+	}
+
+	buf := new(bytes.Buffer)
+	if err := png.Encode(buf, img); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// ReplaceBarcodes replaces $barcode:<type>:<KEY> placeholders with a barcode
+// image of the mapped value. If the placeholder is the only text of the only
+// paragraph of a text frame, the frame content is replaced by the image so it
+// takes the size and position of the frame. Otherwise an inline image is
+// inserted in place of each placeholder, keeping the text and formatting
+// around it.
+func (r *Replacer) ReplaceBarcodes(doc *etree.Document, mapping [][2]string) error {
+	paragraphs := append(doc.FindElements("//text:p"), doc.FindElements("//text:h")...)
+	for _, p := range paragraphs {
+		text := strings.TrimSpace(ElementText(p))
+		textBox := p.Parent()
+		if textBox != nil && textBox.FullTag() == "draw:text-box" && len(textBox.ChildElements()) == 1 {
+			if match := barcodePlaceholder.FindStringSubmatch(text); match != nil && match[0] == text {
+				bc, err := encodeBarcodePlaceholder(match, mapping)
+				if err != nil {
+					return err
+				}
+				img, err := r.barcodeImage(doc, bc)
+				if err != nil {
+					return err
+				}
+				frame := textBox.Parent()
+				frame.RemoveChild(textBox)
+				frame.AddChild(img)
+				continue
+			}
+		}
+
+		err := replaceParagraphTokens(p, barcodePlaceholder, func(match []string) ([]etree.Token, error) {
+			bc, err := encodeBarcodePlaceholder(match, mapping)
+			if err != nil {
+				return nil, err
+			}
+			img, err := r.barcodeImage(doc, bc)
+			if err != nil {
+				return nil, err
+			}
+
+			frame := etree.NewElement("draw:frame")
+			frame.CreateAttr("draw:name", "Barcode "+match[2])
+			frame.CreateAttr("text:anchor-type", "as-char")
+			width, height := barcodeSizeCM(bc)
+			frame.CreateAttr("svg:width", fmt.Sprintf("%.3fcm", width))
+			frame.CreateAttr("svg:height", fmt.Sprintf("%.3fcm", height))
+			frame.AddChild(img)
+			return []etree.Token{frame}, nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// encodeBarcodePlaceholder encodes the mapped value of a matched barcode
+// placeholder.
+func encodeBarcodePlaceholder(match []string, mapping [][2]string) (barcode.Barcode, error) {
+	value, ok := lookupMapping(mapping, match[2])
+	if !ok {
+		return nil, fmt.Errorf("no value for barcode placeholder %s", match[0])
+	}
+	bc, err := EncodeBarcode(match[1], value)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode barcode %s: %w", match[0], err)
+	}
+	return bc, nil
+}
+
+// barcodeImage renders the barcode in the configured format, adds it to the
+// package and returns the draw:image element referencing it.
+func (r *Replacer) barcodeImage(doc *etree.Document, bc barcode.Barcode) (*etree.Element, error) {
+	format := r.BarcodeFormat
+	if format == "" {
+		format = BarcodeSVG
+	}
+
+	var data []byte
+	var mediaType string
+	switch format {
+	case BarcodeSVG:
+		data = BarcodeSVGImage(bc)
+		mediaType = "image/svg+xml"
+	case BarcodePNG:
+		var err error
+		data, err = BarcodePNGImage(bc)
+		if err != nil {
+			return nil, fmt.Errorf("failed to render barcode: %w", err)
+		}
+		mediaType = "image/png"
+	default:
+		return nil, fmt.Errorf("unsupported barcode format: %s", format)
+	}
+
+	name := fmt.Sprintf("Pictures/barcode-%x.%s", sha1.Sum(data), format)
+	href := r.AddFile(name, data, mediaType)
+
+	image := doc.CreateElement("draw:image")
+	image.CreateAttr("xlink:href", href)
+	image.CreateAttr("xlink:type", "simple")
+	image.CreateAttr("xlink:show", "embed")
+	image.CreateAttr("xlink:actuate", "onLoad")
+	image.CreateAttr("draw:mime-type", mediaType)
+	return image, nil
+}
+
+// barcodeSizeCM returns the natural size of a barcode placed without a frame.
+func barcodeSizeCM(bc barcode.Barcode) (float64, float64) {
+	bounds := bc.Bounds()
+	quiet := quietZone(bc)
+	if bc.Metadata().Dimensions == 1 {
+		return float64(bounds.Dx()+2*quiet) * barcodeModuleWidthCM, barcodeHeight1DCM
+	}
+	return float64(bounds.Dx()+2*quiet) * barcodeModuleSize2DCM, float64(bounds.Dy()+2*quiet) * barcodeModuleSize2DCM
+}
+
+// lookupMapping returns the value of a placeholder key, ignoring case.
+func lookupMapping(mapping [][2]string, key string) (string, bool) {
+	for _, pair := range mapping {
+		if strings.EqualFold(pair[0], key) {
+			return pair[1], true
+		}
+	}
+	return "", false
+}
+
+// ElementText returns the text content of an element including all nested
+// spans. Spaces, tabs and line breaks are resolved to their characters, the
+// content of anchored frames and annotations is skipped.
+func ElementText(e *etree.Element) string {
+	var sb strings.Builder
+	for _, token := range e.Child {
+		switch t := token.(type) {
+		case *etree.CharData:
+			sb.WriteString(t.Data)
+		case *etree.Element:
+			switch t.FullTag() {
+			case "text:s":
+				count := 1
+				fmt.Sscanf(t.SelectAttrValue("text:c", "1"), "%d", &count)
+				sb.WriteString(strings.Repeat(" ", count))
+			case "text:tab":
+				sb.WriteString("\t")
+			case "text:line-break":
+				sb.WriteString("\n")
+			case "draw:frame", "draw:a", "office:annotation":
+			default:
+				sb.WriteString(ElementText(t))
+			}
+		}
+	}
+	return sb.String()
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/mheers/godtemplate"
+	"github.com/spf13/cobra"
+)
+
+var (
+	convertCmd = &cobra.Command{
+		Use:   "convert <input> <output>",
+		Short: "Convert documents between the ODT and the flat FODT format or into PDF, DOCX, HTML or PNG",
+		Long: `Convert a document package (.odt) into a flat XML document (.fodt) or back.
+Flat documents are single XML files with embedded pictures, so templates can be
+reviewed and diffed as text.
+
+Other output formats (.pdf, .docx, .html, .png) are produced by the document
+converter selected with --converter.`,
+		Example: `godtemplate convert templates/template.odt templates/template.fodt
+godtemplate convert --converter gotenberg --converter-url http://localhost:3000 invoice.odt invoice.pdf`,
+		Args: cobra.ExactArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return convert(args[0], args[1])
+		},
+	}
+)
+
+func convert(input, output string) error {
+	if godtemplate.IsFlatFile(input) || godtemplate.IsFlatFile(output) {
+		if err := godtemplate.ConvertFlat(input, output); err != nil {
+			return err
+		}
+		fmt.Println("Document converted:", output)
+		return nil
+	}
+
+	format, err := godtemplate.FormatOf(output)
+	if err != nil {
+		return fmt.Errorf("output file must be a flat document (.fodt, .fods, .fodp or .fodg) or have a .pdf, .docx, .html or .png extension: %w", err)
+	}
+	converter, err := newConverter()
+	if err != nil {
+		return err
+	}
+	if err := converter.Convert(context.Background(), input, output, format); err != nil {
+		return fmt.Errorf("failed to convert %s: %w", input, err)
+	}
+	fmt.Println("Document converted:", output)
+	return nil
+}
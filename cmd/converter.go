@@ -0,0 +1,23 @@
+package main
+
+import (
+	"github.com/mheers/godtemplate"
+)
+
+// converter configuration flags, shared by all commands that convert
+// documents
+var converterConfig godtemplate.ConverterConfig
+
+func init() {
+	flags := rootCmd.PersistentFlags()
+	flags.StringVar(&converterConfig.Backend, "converter", "soffice", "Document converter (soffice, listener, gotenberg or fake)")
+	flags.StringVar(&converterConfig.Binary, "converter-binary", "", "soffice binary of the soffice converter or unoconvert client of the listener converter")
+	flags.StringVar(&converterConfig.Host, "converter-host", "", "Host of the soffice listener (default 127.0.0.1)")
+	flags.IntVar(&converterConfig.Port, "converter-port", 0, "Port of the soffice listener (default 2003)")
+	flags.StringVar(&converterConfig.URL, "converter-url", "", "Base URL of the Gotenberg service, e.g. http://localhost:3000")
+}
+
+// newConverter returns the converter selected by the flags.
+func newConverter() (godtemplate.Converter, error) {
+	return godtemplate.NewConverter(converterConfig)
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/mheers/godtemplate"
+	"github.com/spf13/cobra"
+)
+
+var (
+	mergeOutputFile string
+
+	mergeCmd = &cobra.Command{
+		Use:     "merge",
+		Short:   "Merge several ODT documents into one",
+		Long:    `Append ODT documents to the first one, each starting on a new page.`,
+		Example: `godtemplate merge --output /tmp/invoices.[odt|fodt|pdf] invoice1.odt invoice2.odt invoice3.odt`,
+		Args:    cobra.MinimumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return merge(args)
+		},
+	}
+)
+
+func init() {
+	mergeCmd.Flags().StringVarP(&mergeOutputFile, "output", "o", "output.odt", "Output file (pdf, odt or fodt)")
+	mergeCmd.MarkFlagRequired("output")
+}
+
+func merge(inputs []string) error {
+	output := mergeOutputFile
+
+	// check if the output file has a valid extension
+	if len(output) < 4 || (output[len(output)-4:] != ".odt" && output[len(output)-4:] != ".pdf" && !godtemplate.IsFlatFile(output)) {
+		return fmt.Errorf("output file must have a .odt, .fodt or .pdf extension")
+	}
+
+	converter, err := newConverter()
+	if err != nil {
+		return err
+	}
+
+	isPDF := output[len(output)-4:] == ".pdf"
+	if isPDF {
+		output = output[:len(output)-4] + ".odt" // convert to odt for merging
+	}
+
+	if err := godtemplate.Merge(output, inputs...); err != nil {
+		return fmt.Errorf("failed to merge documents: %w", err)
+	}
+
+	if isPDF {
+		if err := converter.Convert(context.Background(), output, output[:len(output)-4]+".pdf", godtemplate.FormatPDF); err != nil {
+			return fmt.Errorf("failed to convert odt to pdf: %w", err)
+		}
+		fmt.Println("Documents merged and converted to PDF:", output[:len(output)-4]+".pdf")
+	} else {
+		fmt.Println("Documents merged:", output)
+	}
+	return nil
+}
@@ -1,8 +1,12 @@
 package main
 
 import (
+	"context"
 	"fmt"
+	"os"
+	"strings"
 
+	"github.com/mheers/godtemplate"
 	"github.com/mheers/godtemplate/invoicerenderer"
 	"github.com/spf13/cobra"
 )
@@ -12,12 +16,14 @@ var (
 	outputFile     string
 	invoiceB64Json string
 	itemsB64Json   string
+	catalogDir     string
+	fallbackLocale string
 
 	renderCmd = &cobra.Command{
 		Use:     "render",
 		Short:   "Render an invoice template",
 		Long:    `Render an invoice template with provided data and items.`,
-		Example: `godtemplate render --template templates/template.odt --output /tmp/output_invoice.[odt|pdf] --invoice <base64-encoded-invoice-json> --items <base64-encoded-items-json>`,
+		Example: `godtemplate render --template templates/template.[odt|docx] --output /tmp/output_invoice.[odt|fodt|docx|pdf] --invoice <base64-encoded-invoice-json> --items <base64-encoded-items-json>`,
 		Args:    cobra.NoArgs,
 		RunE: func(cmd *cobra.Command, args []string) error {
 			return render()
@@ -27,9 +33,11 @@ var (
 
 func init() {
 	renderCmd.Flags().StringVarP(&templateFile, "template", "t", "templates/template.odt", "Input file (must be specified)")
-	renderCmd.Flags().StringVarP(&outputFile, "output", "o", "output.pdf", "Output file (pdf or odt) (default: output.pdf)")
+	renderCmd.Flags().StringVarP(&outputFile, "output", "o", "output.pdf", "Output file (pdf, odt, fodt or docx) (default: output.pdf)")
 	renderCmd.Flags().StringVarP(&invoiceB64Json, "invoice", "i", "", "Invoice data in Bas64 JSON format")
 	renderCmd.Flags().StringVarP(&itemsB64Json, "items", "l", "", "List of invoice items in Bas64 JSON format")
+	renderCmd.Flags().StringVarP(&catalogDir, "catalog", "c", "", "Directory of <locale>.json message files for $t:<key> labels")
+	renderCmd.Flags().StringVar(&fallbackLocale, "fallback-locale", "en", "Locale used for labels missing in the locale of the invoice")
 	renderCmd.MarkFlagRequired("template")
 	renderCmd.MarkFlagRequired("output")
 	renderCmd.MarkFlagRequired("invoice")
@@ -46,13 +54,24 @@ func render() error {
 	}
 
 	// check if the output file has a valid extension
-	if outputFile[len(outputFile)-4:] != ".odt" && outputFile[len(outputFile)-4:] != ".pdf" {
-		return fmt.Errorf("output file must have a .odt or .pdf extension")
+	documentExtension := ".odt"
+	if godtemplate.IsDocxFile(templateFile) {
+		documentExtension = ".docx"
+		if !godtemplate.IsDocxFile(outputFile) && !strings.HasSuffix(outputFile, ".pdf") {
+			return fmt.Errorf("output file of a .docx template must have a .docx or .pdf extension")
+		}
+	} else if outputFile[len(outputFile)-4:] != ".odt" && outputFile[len(outputFile)-4:] != ".pdf" && !godtemplate.IsFlatFile(outputFile) {
+		return fmt.Errorf("output file must have a .odt, .fodt or .pdf extension")
+	}
+
+	converter, err := newConverter()
+	if err != nil {
+		return err
 	}
 
 	isPDF := outputFile[len(outputFile)-4:] == ".pdf"
 	if isPDF {
-		outputFile = outputFile[:len(outputFile)-4] + ".odt" // convert to odt for rendering
+		outputFile = outputFile[:len(outputFile)-4] + documentExtension // convert to odt or docx for rendering
 	}
 
 	var invoiceData invoicerenderer.Invoice
@@ -60,6 +79,19 @@ func render() error {
 		return fmt.Errorf("failed to decode invoice JSON: %w", err)
 	}
 
+	if catalogDir != "" {
+		catalog, err := godtemplate.LoadCatalog(catalogDir, fallbackLocale)
+		if err != nil {
+			return fmt.Errorf("failed to load catalog: %w", err)
+		}
+		invoiceData.Catalog = catalog
+		invoiceData.MissingTranslations = func(missing []godtemplate.MissingTranslation) {
+			for _, m := range missing {
+				fmt.Fprintln(os.Stderr, "warning: missing translation", m)
+			}
+		}
+	}
+
 	var itemsData []invoicerenderer.InvoiceItem
 	if err := invoicerenderer.DecodeBase64JSON(itemsB64Json, &itemsData); err != nil {
 		return fmt.Errorf("failed to decode items JSON: %w", err)
@@ -76,10 +108,11 @@ func render() error {
 
 	if isPDF {
 		// Convert the odt file to pdf
-		if err := invoicerenderer.ConvertODTToPDF(outputFile, outputFile[:len(outputFile)-4]+".pdf"); err != nil {
-			return fmt.Errorf("failed to convert odt to pdf: %w", err)
+		pdfFile := strings.TrimSuffix(outputFile, documentExtension) + ".pdf"
+		if err := converter.Convert(context.Background(), outputFile, pdfFile, godtemplate.FormatPDF); err != nil {
+			return fmt.Errorf("failed to convert %s to pdf: %w", documentExtension[1:], err)
 		}
-		fmt.Println("Invoice rendered and converted to PDF:", outputFile[:len(outputFile)-4]+".pdf")
+		fmt.Println("Invoice rendered and converted to PDF:", pdfFile)
 	} else {
 		fmt.Println("Invoice rendered:", outputFile)
 	}
@@ -23,5 +23,8 @@ func Execute() error {
 func init() {
 	rootCmd.AddCommand(versionCmd)
 	rootCmd.AddCommand(renderCmd)
+	rootCmd.AddCommand(mergeCmd)
+	rootCmd.AddCommand(convertCmd)
+	rootCmd.AddCommand(translationsCmd)
 	rootCmd.AddCommand(serverCmd)
 }
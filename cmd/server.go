@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"os"
 
+	"github.com/mheers/godtemplate"
 	"github.com/mheers/godtemplate/server"
 	"github.com/spf13/cobra"
 )
@@ -24,6 +25,8 @@ var (
 func init() {
 	serverCmd.Flags().StringVarP(&serverPort, "port", "p", "8080", "Port to run the server on")
 	serverCmd.Flags().StringVarP(&templateFile, "template", "t", "templates/template.odt", "Path to the ODT template file")
+	serverCmd.Flags().StringVarP(&catalogDir, "catalog", "c", "", "Directory of <locale>.json message files for $t:<key> labels")
+	serverCmd.Flags().StringVar(&fallbackLocale, "fallback-locale", "en", "Locale used for labels missing in the locale of an invoice")
 }
 
 func startServer() error {
@@ -34,7 +37,19 @@ func startServer() error {
 
 	// Create and start server
 	srv := server.NewServer(serverPort, templateFile)
-	fmt.Printf("Starting godtemplate server on port %s with template %s\n", serverPort, templateFile)
+	converter, err := newConverter()
+	if err != nil {
+		return err
+	}
+	srv.Converter = converter
+	if catalogDir != "" {
+		catalog, err := godtemplate.LoadCatalog(catalogDir, fallbackLocale)
+		if err != nil {
+			return fmt.Errorf("failed to load catalog: %w", err)
+		}
+		srv.Catalog = catalog
+	}
+	fmt.Printf("Starting godtemplate server on port %s with template %s and the %s converter\n", serverPort, templateFile, converterConfig.Backend)
 
 	return srv.Start()
 }
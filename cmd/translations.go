@@ -0,0 +1,73 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/mheers/godtemplate"
+	"github.com/spf13/cobra"
+)
+
+var (
+	translationsLocale string
+
+	translationsCmd = &cobra.Command{
+		Use:     "translations",
+		Short:   "Report missing translations of a template",
+		Long:    `Lists the $t:<key> labels of a template that have no translation in the locales of a catalog.`,
+		Example: `godtemplate translations --template templates/template.odt --catalog templates/i18n [--locale de-CH]`,
+		Args:    cobra.NoArgs,
+		// missing translations are a result, not a usage error
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return reportTranslations()
+		},
+	}
+)
+
+func init() {
+	translationsCmd.Flags().StringVarP(&templateFile, "template", "t", "templates/template.odt", "Path to the ODT template file")
+	translationsCmd.Flags().StringVarP(&catalogDir, "catalog", "c", "", "Directory of <locale>.json message files")
+	translationsCmd.Flags().StringVar(&fallbackLocale, "fallback-locale", "en", "Locale used for labels missing in a locale")
+	translationsCmd.Flags().StringVarP(&translationsLocale, "locale", "l", "", "Only check this locale")
+	translationsCmd.MarkFlagRequired("catalog")
+}
+
+func reportTranslations() error {
+	catalog, err := godtemplate.LoadCatalog(catalogDir, fallbackLocale)
+	if err != nil {
+		return fmt.Errorf("failed to load catalog: %w", err)
+	}
+
+	r := godtemplate.Replacer{}
+	reader, err := r.OpenFile(templateFile)
+	if err != nil {
+		return fmt.Errorf("failed to open template: %w", err)
+	}
+	defer reader.Close()
+
+	doc, _, err := r.GetDocument(reader)
+	if err != nil {
+		return fmt.Errorf("failed to get document: %w", err)
+	}
+	if err := r.ResolveExtends(doc); err != nil {
+		return fmt.Errorf("failed to resolve base template: %w", err)
+	}
+	if err := r.ResolveIncludes(doc); err != nil {
+		return fmt.Errorf("failed to resolve includes: %w", err)
+	}
+
+	keys := godtemplate.TranslationKeys(doc)
+	missing := catalog.Missing(keys)
+	if translationsLocale != "" {
+		missing = catalog.MissingIn(translationsLocale, keys)
+	}
+
+	for _, m := range missing {
+		fmt.Println(m)
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("%d missing translations of %d labels", len(missing), len(keys))
+	}
+	fmt.Printf("All %d labels are translated\n", len(keys))
+	return nil
+}
@@ -0,0 +1,288 @@
+package godtemplate
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// ConvertFormat is the target format of a document conversion.
+type ConvertFormat string
+
+const (
+	FormatPDF  ConvertFormat = "pdf"
+	FormatDOCX ConvertFormat = "docx"
+	FormatHTML ConvertFormat = "html"
+	// FormatPNG renders the first page of the document.
+	FormatPNG ConvertFormat = "png"
+)
+
+// ErrUnsupportedFormat is returned by converters that cannot produce a
+// format.
+var ErrUnsupportedFormat = errors.New("unsupported conversion format")
+
+// Converter converts a document (.odt, .docx, ...) into another format,
+// usually by means of LibreOffice.
+type Converter interface {
+	Convert(ctx context.Context, input, output string, format ConvertFormat) error
+}
+
+// DefaultConverter is used by ConvertODTToPDF.
+var DefaultConverter Converter = &SofficeConverter{}
+
+// FormatOf returns the conversion format of a file by its extension.
+func FormatOf(name string) (ConvertFormat, error) {
+	format := ConvertFormat(strings.ToLower(strings.TrimPrefix(filepath.Ext(name), ".")))
+	switch format {
+	case FormatPDF, FormatDOCX, FormatHTML, FormatPNG:
+		return format, nil
+	case "htm":
+		return FormatHTML, nil
+	default:
+		return "", fmt.Errorf("%w: %s", ErrUnsupportedFormat, filepath.Ext(name))
+	}
+}
+
+// ConverterConfig selects and configures a converter, e.g. from command line
+// flags or the configuration of the server.
+type ConverterConfig struct {
+	// Backend is one of "soffice" (default), "listener", "gotenberg" or
+	// "fake".
+	Backend string `json:"backend"`
+	// Binary is the soffice binary of the soffice backend or the unoconvert
+	// client of the listener backend.
+	Binary string `json:"binary"`
+	// Host and Port are the address of the listener.
+	Host string `json:"host"`
+	Port int    `json:"port"`
+	// URL is the base URL of the Gotenberg service.
+	URL string `json:"url"`
+}
+
+// NewConverter returns the converter selected by config.
+func NewConverter(config ConverterConfig) (Converter, error) {
+	switch config.Backend {
+	case "", "soffice":
+		return &SofficeConverter{Binary: config.Binary}, nil
+	case "listener":
+		return &ListenerConverter{Binary: config.Binary, Host: config.Host, Port: config.Port}, nil
+	case "gotenberg":
+		if config.URL == "" {
+			return nil, fmt.Errorf("the gotenberg converter requires a URL")
+		}
+		return &GotenbergConverter{URL: config.URL}, nil
+	case "fake":
+		return &FakeConverter{}, nil
+	default:
+		return nil, fmt.Errorf("unknown converter: %s", config.Backend)
+	}
+}
+
+// sofficeFilters are the --convert-to arguments of soffice by format.
+var sofficeFilters = map[ConvertFormat]string{
+	FormatPDF:  "pdf",
+	FormatDOCX: `docx:MS Word 2007 XML`,
+	FormatHTML: "html",
+	FormatPNG:  "png",
+}
+
+// SofficeConverter converts documents by starting a headless soffice process
+// for every conversion.
+type SofficeConverter struct {
+	// Binary is the soffice binary. If empty, libreoffice is used.
+	Binary string
+}
+
+// Convert runs `soffice --headless --convert-to <format>` in a temporary
+// directory next to output and moves the result to output.
+func (c *SofficeConverter) Convert(ctx context.Context, input, output string, format ConvertFormat) error {
+	filter, ok := sofficeFilters[format]
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrUnsupportedFormat, format)
+	}
+	binary := c.Binary
+	if binary == "" {
+		binary = "libreoffice"
+	}
+
+	// soffice names the result after the input, so it is written into an
+	// empty directory on the file system of output and renamed from there
+	outDir, err := os.MkdirTemp(filepath.Dir(output), ".convert-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(outDir)
+
+	cmd := exec.CommandContext(ctx, binary, "--headless", "--convert-to", filter, input, "--outdir", outDir)
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("libreoffice conversion failed: %w\noutput: %s", err, string(out))
+	}
+
+	name := strings.TrimSuffix(filepath.Base(input), filepath.Ext(input)) + "." + string(format)
+	if err := os.Rename(filepath.Join(outDir, name), output); err != nil {
+		return fmt.Errorf("libreoffice conversion failed: %w\noutput: %s", err, string(out))
+	}
+	return nil
+}
+
+// ListenerConverter converts documents with a long-running soffice listener,
+// which saves the start of LibreOffice for every document. The listener is
+// run by unoserver (`unoserver --port 2003`); documents are sent to it with
+// its unoconvert client.
+type ListenerConverter struct {
+	// Binary is the unoconvert client. If empty, unoconvert is used.
+	Binary string
+	// Host and Port are the address of the listener. If empty, 127.0.0.1
+	// and 2003 are used.
+	Host string
+	Port int
+}
+
+// Convert sends input to the listener and writes the result to output.
+func (c *ListenerConverter) Convert(ctx context.Context, input, output string, format ConvertFormat) error {
+	if _, ok := sofficeFilters[format]; !ok {
+		return fmt.Errorf("%w: %s", ErrUnsupportedFormat, format)
+	}
+	binary := c.Binary
+	if binary == "" {
+		binary = "unoconvert"
+	}
+	host := c.Host
+	if host == "" {
+		host = "127.0.0.1"
+	}
+	port := c.Port
+	if port == 0 {
+		port = 2003
+	}
+
+	cmd := exec.CommandContext(ctx, binary, "--host", host, "--port", strconv.Itoa(port), "--convert-to", string(format), input, output)
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("listener conversion failed: %w\noutput: %s", err, string(out))
+	}
+	return nil
+}
+
+// GotenbergConverter converts documents to PDF with the LibreOffice route of
+// a Gotenberg (or compatible) service. Other formats are not supported.
+type GotenbergConverter struct {
+	// URL is the base URL of the service, e.g. http://gotenberg:3000.
+	URL string
+	// Client sends the requests. If nil, http.DefaultClient is used.
+	Client *http.Client
+}
+
+// Convert uploads input to /forms/libreoffice/convert and writes the
+// returned PDF to output.
+func (c *GotenbergConverter) Convert(ctx context.Context, input, output string, format ConvertFormat) error {
+	if format != FormatPDF {
+		return fmt.Errorf("%w: %s", ErrUnsupportedFormat, format)
+	}
+
+	data, err := os.ReadFile(input)
+	if err != nil {
+		return err
+	}
+
+	body := new(bytes.Buffer)
+	form := multipart.NewWriter(body)
+	part, err := form.CreateFormFile("files", filepath.Base(input))
+	if err != nil {
+		return err
+	}
+	if _, err := part.Write(data); err != nil {
+		return err
+	}
+	if err := form.Close(); err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, strings.TrimSuffix(c.URL, "/")+"/forms/libreoffice/convert", body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", form.FormDataContentType())
+
+	client := c.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("gotenberg conversion failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		message, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("gotenberg conversion failed: %s: %s", resp.Status, strings.TrimSpace(string(message)))
+	}
+
+	file, err := os.Create(output)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	if _, err := io.Copy(file, resp.Body); err != nil {
+		return err
+	}
+	return file.Close()
+}
+
+// Conversion is a conversion recorded by FakeConverter.
+type Conversion struct {
+	Input  string
+	Output string
+	Format ConvertFormat
+}
+
+// FakeConverter records conversions instead of running LibreOffice, for
+// tests of code that converts documents. It writes Data, or a short text
+// naming the conversion if Data is nil, to the output.
+type FakeConverter struct {
+	// Data is written to the output of every conversion.
+	Data []byte
+	// Err is returned by Convert if set; nothing is written then.
+	Err error
+
+	mu          sync.Mutex
+	conversions []Conversion
+}
+
+// Convert records the conversion and writes the output.
+func (c *FakeConverter) Convert(ctx context.Context, input, output string, format ConvertFormat) error {
+	c.mu.Lock()
+	c.conversions = append(c.conversions, Conversion{Input: input, Output: output, Format: format})
+	c.mu.Unlock()
+
+	if c.Err != nil {
+		return c.Err
+	}
+	if _, err := os.Stat(input); err != nil {
+		return err
+	}
+	data := c.Data
+	if data == nil {
+		data = []byte(fmt.Sprintf("%s converted to %s\n", filepath.Base(input), format))
+	}
+	return os.WriteFile(output, data, 0o644)
+}
+
+// Conversions returns the conversions recorded so far.
+func (c *FakeConverter) Conversions() []Conversion {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]Conversion(nil), c.conversions...)
+}
@@ -0,0 +1,167 @@
+package godtemplate
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestNewConverter(t *testing.T) {
+	tests := []struct {
+		config ConverterConfig
+		want   Converter
+	}{
+		{ConverterConfig{}, &SofficeConverter{}},
+		{ConverterConfig{Backend: "soffice", Binary: "/opt/soffice"}, &SofficeConverter{Binary: "/opt/soffice"}},
+		{ConverterConfig{Backend: "listener", Host: "office", Port: 2004}, &ListenerConverter{Host: "office", Port: 2004}},
+		{ConverterConfig{Backend: "gotenberg", URL: "http://gotenberg:3000"}, &GotenbergConverter{URL: "http://gotenberg:3000"}},
+		{ConverterConfig{Backend: "fake"}, &FakeConverter{}},
+	}
+	for _, test := range tests {
+		got, err := NewConverter(test.config)
+		if err != nil {
+			t.Errorf("NewConverter(%+v): %v", test.config, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("NewConverter(%+v) = %#v, want %#v", test.config, got, test.want)
+		}
+	}
+}
+
+func TestNewConverterErrors(t *testing.T) {
+	for _, config := range []ConverterConfig{{Backend: "gotenberg"}, {Backend: "unknown"}} {
+		if _, err := NewConverter(config); err == nil {
+			t.Errorf("NewConverter(%+v) succeeded, want an error", config)
+		}
+	}
+}
+
+func TestFormatOf(t *testing.T) {
+	tests := map[string]ConvertFormat{
+		"invoice.pdf":  FormatPDF,
+		"invoice.DOCX": FormatDOCX,
+		"invoice.htm":  FormatHTML,
+		"invoice.png":  FormatPNG,
+	}
+	for name, want := range tests {
+		got, err := FormatOf(name)
+		if err != nil || got != want {
+			t.Errorf("FormatOf(%q) = %q, %v, want %q", name, got, err, want)
+		}
+	}
+	if _, err := FormatOf("invoice.odt"); !errors.Is(err, ErrUnsupportedFormat) {
+		t.Errorf("FormatOf(invoice.odt) error = %v, want ErrUnsupportedFormat", err)
+	}
+}
+
+func TestFakeConverter(t *testing.T) {
+	dir := t.TempDir()
+	input := filepath.Join(dir, "invoice.odt")
+	if err := os.WriteFile(input, []byte("odt"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	c := &FakeConverter{}
+	output := filepath.Join(dir, "invoice.pdf")
+	if err := c.Convert(context.Background(), input, output, FormatPDF); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := string(data), "invoice.odt converted to pdf\n"; got != want {
+		t.Errorf("output = %q, want %q", got, want)
+	}
+
+	c.Data = []byte("%PDF")
+	if err := c.Convert(context.Background(), input, output, FormatPDF); err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := os.ReadFile(output); string(data) != "%PDF" {
+		t.Errorf("output = %q, want Data", data)
+	}
+
+	want := []Conversion{
+		{Input: input, Output: output, Format: FormatPDF},
+		{Input: input, Output: output, Format: FormatPDF},
+	}
+	if got := c.Conversions(); !reflect.DeepEqual(got, want) {
+		t.Errorf("Conversions() = %v, want %v", got, want)
+	}
+}
+
+func TestFakeConverterErrors(t *testing.T) {
+	dir := t.TempDir()
+	input := filepath.Join(dir, "invoice.odt")
+	if err := os.WriteFile(input, []byte("odt"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	output := filepath.Join(dir, "invoice.pdf")
+
+	failure := errors.New("conversion failed")
+	c := &FakeConverter{Err: failure}
+	if err := c.Convert(context.Background(), input, output, FormatPDF); !errors.Is(err, failure) {
+		t.Errorf("Convert() error = %v, want %v", err, failure)
+	}
+	if _, err := os.Stat(output); !os.IsNotExist(err) {
+		t.Errorf("output was written despite Err")
+	}
+
+	c = &FakeConverter{}
+	if err := c.Convert(context.Background(), filepath.Join(dir, "missing.odt"), output, FormatPDF); err == nil {
+		t.Errorf("Convert() of a missing input succeeded")
+	}
+	if got := len(c.Conversions()); got != 1 {
+		t.Errorf("len(Conversions()) = %d, want 1", got)
+	}
+}
+
+func TestGotenbergConverter(t *testing.T) {
+	var path, file string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		path = req.URL.Path
+		f, header, err := req.FormFile("files")
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		defer f.Close()
+		data, _ := io.ReadAll(f)
+		file = header.Filename + ":" + string(data)
+		w.Write([]byte("%PDF"))
+	}))
+	defer server.Close()
+
+	dir := t.TempDir()
+	input := filepath.Join(dir, "invoice.odt")
+	if err := os.WriteFile(input, []byte("odt"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	output := filepath.Join(dir, "invoice.pdf")
+
+	c := &GotenbergConverter{URL: server.URL + "/"}
+	if err := c.Convert(context.Background(), input, output, FormatPDF); err != nil {
+		t.Fatal(err)
+	}
+	if path != "/forms/libreoffice/convert" {
+		t.Errorf("request path = %q", path)
+	}
+	if file != "invoice.odt:odt" {
+		t.Errorf("uploaded file = %q", file)
+	}
+	if data, _ := os.ReadFile(output); string(data) != "%PDF" {
+		t.Errorf("output = %q", data)
+	}
+
+	if err := c.Convert(context.Background(), input, output, FormatDOCX); !errors.Is(err, ErrUnsupportedFormat) {
+		t.Errorf("Convert() to docx error = %v, want ErrUnsupportedFormat", err)
+	}
+}
@@ -0,0 +1,475 @@
+package godtemplate
+
+import (
+	"archive/zip"
+	"bytes"
+	"fmt"
+	"io"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/beevik/etree"
+)
+
+// DocxDocumentPart is the main part of a Word document.
+const DocxDocumentPart = "word/document.xml"
+
+// docxPartPattern matches the parts of a Word document with text: the main
+// document, headers, footers, footnotes and endnotes.
+var docxPartPattern = regexp.MustCompile(`^word/(document|header[0-9]*|footer[0-9]*|footnotes|endnotes)\.xml$`)
+
+// docxPlaceholderPattern matches placeholders like $NAME, $item.price:number
+// or $t:invoice.due_date in the text of a Word paragraph.
+var docxPlaceholderPattern = regexp.MustCompile(`\$[A-Za-z0-9_]+(?:[.:-][A-Za-z0-9_]+)*`)
+
+// IsDocxFile reports whether name is a Word document (.docx) by its
+// extension.
+func IsDocxFile(name string) bool {
+	return strings.EqualFold(filepath.Ext(name), ".docx")
+}
+
+// isDocx reports whether doc is a part of a Word document.
+func isDocx(doc *etree.Document) bool {
+	root := doc.Root()
+	return root != nil && root.Space == "w"
+}
+
+// GetDocxParts reads and parses the parts of a Word (.docx) package that
+// contain text, keyed by their name: DocxDocumentPart, word/header1.xml,
+// word/footer1.xml, ... The runs of all parts are normalized with
+// NormalizeRuns, so each placeholder is part of a single run.
+func (r *Replacer) GetDocxParts(zipReader *zip.ReadCloser) (map[string]*etree.Document, error) {
+	parts := map[string]*etree.Document{}
+	for _, f := range zipReader.File {
+		if !docxPartPattern.MatchString(f.Name) {
+			continue
+		}
+		rc, err := f.Open()
+		if err != nil {
+			return nil, err
+		}
+		buf := new(bytes.Buffer)
+		_, err = io.Copy(buf, rc)
+		rc.Close()
+		if err != nil {
+			return nil, err
+		}
+
+		doc := etree.NewDocument()
+		if err := doc.ReadFromBytes(buf.Bytes()); err != nil {
+			return nil, fmt.Errorf("failed to parse %s: %w", f.Name, err)
+		}
+		r.NormalizeRuns(doc)
+		parts[f.Name] = doc
+	}
+	if parts[DocxDocumentPart] == nil {
+		return nil, fmt.Errorf("%s not found", DocxDocumentPart)
+	}
+	return parts, nil
+}
+
+// WriteDocx writes the parts into a copy of the Word package srcPath.
+func (r *Replacer) WriteDocx(srcPath, dstPath string, parts map[string]*etree.Document) error {
+	names := make([]string, 0, len(parts))
+	for name := range parts {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		data, err := parts[name].WriteToBytes()
+		if err != nil {
+			return fmt.Errorf("failed to write %s: %w", name, err)
+		}
+		r.AddFile(name, data, "application/xml")
+	}
+	// a Word package has no content.xml, so only the parts are replaced
+	return r.WriteContent(srcPath, dstPath, "")
+}
+
+// NormalizeRuns is the Word counterpart of NormalizePlaceholderSpans. Word
+// splits text into several runs (w:r) when it is partly formatted, checked
+// for spelling or edited at different times, e.g. "$" and "NAME" in
+// separate runs. The text of every placeholder is moved into the run it
+// starts in, and runs left empty are removed. Spelling markers (w:proofErr)
+// are removed as well.
+func (r *Replacer) NormalizeRuns(doc *etree.Document) {
+	for _, marker := range doc.FindElements("//w:proofErr") {
+		marker.Parent().RemoveChild(marker)
+	}
+	for _, p := range doc.FindElements("//w:p") {
+		normalizeParagraphRuns(p)
+	}
+}
+
+func normalizeParagraphRuns(p *etree.Element) {
+	// texts holds the w:t elements of the paragraph; nil separates texts
+	// that are not adjacent, e.g. around a tab or a picture.
+	texts := []*etree.Element{}
+	collectRunTexts(p, &texts)
+
+	var sb strings.Builder
+	starts := make([]int, 0, len(texts))
+	for _, t := range texts {
+		starts = append(starts, sb.Len())
+		if t == nil {
+			sb.WriteString("\x00")
+		} else {
+			sb.WriteString(t.Text())
+		}
+	}
+	text := sb.String()
+
+	// owned is the range of the paragraph text each w:t keeps
+	owned := make([][2]int, len(texts))
+	for i := range texts {
+		end := len(text)
+		if i+1 < len(texts) {
+			end = starts[i+1]
+		}
+		owned[i] = [2]int{starts[i], end}
+	}
+
+	changed := map[int]bool{}
+	for _, m := range docxPlaceholderPattern.FindAllStringIndex(text, -1) {
+		first := nodeAt(starts, m[0])
+		last := nodeAt(starts, m[1]-1)
+		if first == last {
+			continue
+		}
+		owned[first][1] = m[1]
+		changed[first] = true
+		for k := first + 1; k <= last; k++ {
+			owned[k][0] = max(owned[k][0], m[1])
+			changed[k] = true
+		}
+	}
+
+	for i := range changed {
+		t := texts[i]
+		t.SetText(text[owned[i][0]:max(owned[i][0], owned[i][1])])
+		t.CreateAttr("xml:space", "preserve")
+		if t.Text() != "" {
+			continue
+		}
+		run := t.Parent()
+		run.RemoveChild(t)
+		if isEmptyRun(run) {
+			run.Parent().RemoveChild(run)
+		}
+	}
+}
+
+// collectRunTexts collects the w:t elements of the runs of a paragraph in
+// document order. Other run content like tabs, breaks and pictures is added
+// as nil. Paragraphs nested in text boxes are skipped; they are normalized
+// separately.
+func collectRunTexts(e *etree.Element, texts *[]*etree.Element) {
+	for _, child := range e.ChildElements() {
+		switch {
+		case child.FullTag() == "w:t":
+			*texts = append(*texts, child)
+		case child.FullTag() == "w:rPr" || child.FullTag() == "w:pPr":
+		case e.FullTag() == "w:r" || child.FullTag() == "w:p":
+			*texts = append(*texts, nil)
+		default:
+			collectRunTexts(child, texts)
+		}
+	}
+}
+
+// isEmptyRun reports whether a run has no content besides its properties.
+func isEmptyRun(run *etree.Element) bool {
+	for _, child := range run.ChildElements() {
+		if child.FullTag() != "w:rPr" {
+			return false
+		}
+	}
+	return true
+}
+
+// DocxText returns the text of the runs of a Word element, e.g. a paragraph
+// or a table row.
+func DocxText(e *etree.Element) string {
+	var sb strings.Builder
+	for _, t := range e.FindElements(".//w:t") {
+		sb.WriteString(t.Text())
+	}
+	return sb.String()
+}
+
+// ReplaceDocxValues replaces the placeholders of mapping (see ReplaceValues)
+// in a part of a Word document. Values are escaped as needed, and line breaks
+// in values become w:br elements.
+func (r *Replacer) ReplaceDocxValues(doc *etree.Document, mapping [][2]string) {
+	for _, t := range doc.FindElements("//w:t") {
+		text := t.Text()
+		if !strings.Contains(text, "$") {
+			continue
+		}
+		for _, pair := range mapping {
+			text = strings.ReplaceAll(text, "$"+strings.ToUpper(pair[0]), pair[1])
+		}
+		if text != t.Text() {
+			setRunText(t, text)
+		}
+	}
+}
+
+// replaceDocxText replaces all matches of re in the runs of e. Matches must
+// not be split over several runs, see NormalizeRuns.
+func replaceDocxText(e *etree.Element, re *regexp.Regexp, replace func(match []string) (string, error)) error {
+	for _, t := range e.FindElements(".//w:t") {
+		var err error
+		text := re.ReplaceAllStringFunc(t.Text(), func(match string) string {
+			if err != nil {
+				return match
+			}
+			var value string
+			value, err = replace(re.FindStringSubmatch(match))
+			return value
+		})
+		if err != nil {
+			return err
+		}
+		if text != t.Text() {
+			setRunText(t, text)
+		}
+	}
+	return nil
+}
+
+// setRunText sets the text of a w:t element. Line breaks are converted to
+// w:br elements between several w:t elements of the run.
+func setRunText(t *etree.Element, text string) {
+	lines := strings.Split(text, "\n")
+	t.SetText(lines[0])
+	t.CreateAttr("xml:space", "preserve")
+
+	run := t.Parent()
+	index := t.Index()
+	for _, line := range lines[1:] {
+		index++
+		run.InsertChildAt(index, etree.NewElement("w:br"))
+		next := etree.NewElement("w:t")
+		next.CreateAttr("xml:space", "preserve")
+		next.SetText(line)
+		index++
+		run.InsertChildAt(index, next)
+	}
+}
+
+// getDocxTable returns the table whose title (alternative text, stored as
+// w:tblCaption) is name.
+func getDocxTable(doc *etree.Document, name string) *etree.Element {
+	for _, table := range doc.FindElements("//w:tbl") {
+		caption := table.FindElement("w:tblPr/w:tblCaption")
+		if caption != nil && caption.SelectAttrValue("w:val", "") == name {
+			return table
+		}
+	}
+	return nil
+}
+
+// insertDocxPrototypeRow inserts a copy of a Word table row in front of the
+// row before and replaces its placeholders with the given prefix by the text
+// of their values.
+func insertDocxPrototypeRow(prototype, before *etree.Element, prefix string, values RowValues) (*etree.Element, error) {
+	row := prototype.Copy()
+	removeDocxIDs(row)
+	err := replaceDocxText(row, prototypePattern(prefix), func(match []string) (string, error) {
+		value, err := values(strings.ToLower(match[1]), strings.ToLower(match[2]))
+		return value.Text, err
+	})
+	if err != nil {
+		return nil, err
+	}
+	before.Parent().InsertChildAt(before.Index(), row)
+	return row, nil
+}
+
+// insertDocxRow appends a copy of a Word table row with the text of values.
+func insertDocxRow(table, templateRow *etree.Element, values []CellValue) (*etree.Element, error) {
+	row := templateRow.Copy()
+	removeDocxIDs(row)
+	cells := row.SelectElements("w:tc")
+	if len(values) > len(cells) {
+		return nil, fmt.Errorf("template row has %d cells, but %d values were given", len(cells), len(values))
+	}
+	for i, cell := range cells {
+		text := ""
+		if i < len(values) {
+			text = values[i].Text
+		}
+		fillDocxCell(cell, text)
+	}
+	table.AddChild(row)
+	return row, nil
+}
+
+// fillDocxCell replaces the content of a Word table cell by text. The
+// paragraph and run properties of the first paragraph and run of the cell
+// are kept.
+func fillDocxCell(cell *etree.Element, text string) {
+	paragraphs := cell.SelectElements("w:p")
+	p := etree.NewElement("w:p")
+	if len(paragraphs) > 0 {
+		p = paragraphs[0]
+	} else {
+		cell.AddChild(p)
+	}
+	for _, other := range paragraphs[min(1, len(paragraphs)):] {
+		cell.RemoveChild(other)
+	}
+
+	var properties *etree.Element
+	if run := p.FindElement(".//w:r/w:rPr"); run != nil {
+		properties = run.Copy()
+	}
+	for _, child := range p.ChildElements() {
+		if child.FullTag() != "w:pPr" {
+			p.RemoveChild(child)
+		}
+	}
+	if text == "" {
+		return
+	}
+
+	run := p.CreateElement("w:r")
+	if properties != nil {
+		run.AddChild(properties)
+	}
+	setRunText(run.CreateElement("w:t"), text)
+}
+
+// getDocxRowStyles returns the cells of a Word table row as TableEntryStyles
+// with their paragraph style, so the number of cells is known.
+func getDocxRowStyles(row *etree.Element) []TableEntryStyle {
+	cells := row.SelectElements("w:tc")
+	styles := make([]TableEntryStyle, 0, len(cells))
+	for _, cell := range cells {
+		textStyle := ""
+		if style := cell.FindElement("w:p/w:pPr/w:pStyle"); style != nil {
+			textStyle = style.SelectAttrValue("w:val", "")
+		}
+		styles = append(styles, TableEntryStyle{TextStyle: textStyle})
+	}
+	return styles
+}
+
+// fillDocxList fills a list of a Word document: the first paragraph with a
+// placeholder of the list is copied for every entry. Nested entries are
+// indented by one list level.
+func fillDocxList(doc *etree.Document, data ListData, format func(any, string) (string, error)) error {
+	pattern := listPattern(data.Name)
+	var prototype *etree.Element
+	for _, p := range doc.FindElements("//w:p") {
+		if pattern.MatchString(DocxText(p)) {
+			prototype = p
+			break
+		}
+	}
+	if prototype == nil {
+		return fmt.Errorf("list %s not found", data.Name)
+	}
+
+	paragraphs, err := buildDocxListItems(prototype, pattern, data.Items, format, 0)
+	if err != nil {
+		return fmt.Errorf("failed to fill list %s: %w", data.Name, err)
+	}
+	parent := prototype.Parent()
+	for _, p := range paragraphs {
+		parent.InsertChildAt(prototype.Index(), p)
+	}
+	parent.RemoveChild(prototype)
+	return nil
+}
+
+func buildDocxListItems(prototype *etree.Element, pattern *regexp.Regexp, entries []any, format func(any, string) (string, error), depth int) ([]*etree.Element, error) {
+	paragraphs := []*etree.Element{}
+	for _, entry := range entries {
+		p := prototype.Copy()
+		removeDocxIDs(p)
+		if depth > 0 {
+			if level := p.FindElement("w:pPr/w:numPr/w:ilvl"); level != nil {
+				current := 0
+				fmt.Sscanf(level.SelectAttrValue("w:val", "0"), "%d", &current)
+				level.CreateAttr("w:val", fmt.Sprint(current+depth))
+			}
+		}
+
+		err := replaceDocxText(p, pattern, func(match []string) (string, error) {
+			value, err := listValue(entry, strings.ToLower(match[1]))
+			if err != nil {
+				return "", err
+			}
+			return format(value, strings.ToLower(match[2]))
+		})
+		if err != nil {
+			return nil, err
+		}
+		paragraphs = append(paragraphs, p)
+
+		if children := listChildren(entry); len(children) > 0 {
+			nested, err := buildDocxListItems(prototype, pattern, children, format, depth+1)
+			if err != nil {
+				return nil, err
+			}
+			paragraphs = append(paragraphs, nested...)
+		}
+	}
+	return paragraphs, nil
+}
+
+// removeDocxIDs removes the paragraph ids and bookmarks of a copied element,
+// which must stay unique in the document.
+func removeDocxIDs(e *etree.Element) {
+	for _, element := range append([]*etree.Element{e}, e.FindElements(".//*")...) {
+		element.RemoveAttr("w14:paraId")
+		element.RemoveAttr("w14:textId")
+	}
+	for _, bookmark := range append(e.FindElements(".//w:bookmarkStart"), e.FindElements(".//w:bookmarkEnd")...) {
+		bookmark.Parent().RemoveChild(bookmark)
+	}
+}
+
+// splitDocxTable moves row and all rows after it into a copy of the Word
+// table, separated by a minimal paragraph that starts a new page. Header rows
+// are copied; the title is left to the first table.
+func splitDocxTable(table, row *etree.Element) *etree.Element {
+	split := table.Copy()
+	for _, child := range split.ChildElements() {
+		switch {
+		case child.FullTag() == "w:tblPr" || child.FullTag() == "w:tblGrid":
+		case child.FullTag() == "w:tr" && child.FindElement("w:trPr/w:tblHeader") != nil:
+		default:
+			split.RemoveChild(child)
+		}
+	}
+	if caption := split.FindElement("w:tblPr/w:tblCaption"); caption != nil {
+		caption.Parent().RemoveChild(caption)
+	}
+	removeDocxIDs(split)
+
+	if row != nil {
+		for _, moved := range followingElements(row) {
+			split.AddChild(moved)
+		}
+	}
+
+	pageBreak := etree.NewElement("w:p")
+	properties := pageBreak.CreateElement("w:pPr")
+	properties.CreateElement("w:pageBreakBefore")
+	spacing := properties.CreateElement("w:spacing")
+	spacing.CreateAttr("w:before", "0")
+	spacing.CreateAttr("w:after", "0")
+	spacing.CreateAttr("w:line", "1")
+	spacing.CreateAttr("w:lineRule", "exact")
+
+	parent := table.Parent()
+	parent.InsertChildAt(table.Index()+1, pageBreak)
+	parent.InsertChildAt(pageBreak.Index()+1, split)
+	return split
+}
@@ -0,0 +1,86 @@
+package godtemplate
+
+import (
+	"testing"
+
+	"github.com/beevik/etree"
+)
+
+// docxParagraph returns a Word document with one paragraph of the given runs.
+func docxParagraph(t *testing.T, runs string) *etree.Document {
+	t.Helper()
+	doc := etree.NewDocument()
+	if err := doc.ReadFromString(`<w:document xmlns:w="w"><w:body><w:p>` + runs + `</w:p></w:body></w:document>`); err != nil {
+		t.Fatal(err)
+	}
+	return doc
+}
+
+func runTexts(doc *etree.Document) []string {
+	texts := []string{}
+	for _, text := range doc.FindElements("//w:t") {
+		texts = append(texts, text.Text())
+	}
+	return texts
+}
+
+func TestNormalizeRuns(t *testing.T) {
+	tests := []struct {
+		name string
+		runs string
+		want []string
+	}{
+		{
+			name: "placeholder split into runs",
+			runs: `<w:r><w:t>Dear $</w:t></w:r><w:r><w:rPr><w:b/></w:rPr><w:t>NA</w:t></w:r><w:r><w:t>ME,</w:t></w:r>`,
+			want: []string{"Dear $NAME", ","},
+		},
+		{
+			name: "spelling markers",
+			runs: `<w:r><w:t>$item.</w:t></w:r><w:proofErr w:type="spellStart"/><w:r><w:t>price:number</w:t></w:r><w:proofErr w:type="spellEnd"/>`,
+			want: []string{"$item.price:number"},
+		},
+		{
+			name: "placeholder in one run",
+			runs: `<w:r><w:t>$NAME</w:t></w:r><w:r><w:t> and more</w:t></w:r>`,
+			want: []string{"$NAME", " and more"},
+		},
+		{
+			name: "tab between runs",
+			runs: `<w:r><w:t>$</w:t><w:tab/><w:t>NAME</w:t></w:r>`,
+			want: []string{"$", "NAME"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			doc := docxParagraph(t, test.runs)
+			(&Replacer{}).NormalizeRuns(doc)
+
+			got := runTexts(doc)
+			if len(got) != len(test.want) {
+				t.Fatalf("texts = %q, want %q", got, test.want)
+			}
+			for i := range got {
+				if got[i] != test.want[i] {
+					t.Fatalf("texts = %q, want %q", got, test.want)
+				}
+			}
+			if doc.FindElement("//w:proofErr") != nil {
+				t.Errorf("spelling markers were kept")
+			}
+		})
+	}
+}
+
+func TestNormalizeRunsRemovesEmptyRuns(t *testing.T) {
+	doc := docxParagraph(t, `<w:r><w:t>$</w:t></w:r><w:r><w:rPr><w:i/></w:rPr><w:t>NAME</w:t></w:r>`)
+	(&Replacer{}).NormalizeRuns(doc)
+
+	runs := doc.FindElements("//w:r")
+	if len(runs) != 1 {
+		t.Fatalf("%d runs left, want 1", len(runs))
+	}
+	if got := DocxText(doc.Root()); got != "$NAME" {
+		t.Errorf("text = %q, want $NAME", got)
+	}
+}
@@ -0,0 +1,273 @@
+package godtemplate
+
+import (
+	"archive/zip"
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+
+	"github.com/beevik/etree"
+)
+
+// extendsPattern matches paragraphs like "$EXTENDS base"
+var extendsPattern = regexp.MustCompile(`^\s*\$EXTENDS\s+(\S+)\s*$`)
+
+// blockPrefix is the prefix of the automatic styles and pictures copied along
+// with overriding sections.
+const blockPrefix = "block_"
+
+// ResolveExtends lets a template extend a base template. If the body of the
+// document contains a paragraph "$EXTENDS <name>", the document is replaced
+// by the body of <name>.odt (looked up like includes), where every section
+// (text:section) named like a top level section of the template is replaced
+// by that section. Content of the template outside of sections is ignored.
+// The base template may extend another template in turn.
+//
+// The result is written into the package of the base template, so its page
+// layouts, headers, footers and settings apply; page headers and footers of
+// the template cannot override them, as they are part of its master pages,
+// not of its body. The automatic styles and pictures used by the overriding
+// sections are copied along, as are the common styles of the template
+// missing in the base template. The document must have been opened with
+// OpenFile.
+func (r *Replacer) ResolveExtends(doc *etree.Document) error {
+	for depth := 0; ; depth++ {
+		p := extendsParagraph(doc)
+		if p == nil {
+			return nil
+		}
+		if depth == maxIncludeDepth {
+			return fmt.Errorf("templates are extended deeper than %d levels", maxIncludeDepth)
+		}
+
+		name := extendsPattern.FindStringSubmatch(ElementText(p))[1]
+		if err := r.extend(doc, name); err != nil {
+			return fmt.Errorf("failed to extend %s: %w", name, err)
+		}
+	}
+}
+
+func extendsParagraph(doc *etree.Document) *etree.Element {
+	text := doc.Root().FindElement("office:body/office:text")
+	if text == nil {
+		return nil
+	}
+	for _, p := range text.ChildElements() {
+		if (p.FullTag() == "text:p" || p.FullTag() == "text:h") && extendsPattern.MatchString(ElementText(p)) {
+			return p
+		}
+	}
+	return nil
+}
+
+// extend replaces the content of doc by the content of the base template
+// name with the sections of doc.
+func (r *Replacer) extend(doc *etree.Document, name string) error {
+	current := r.basePackage
+	if current == "" {
+		current = r.template
+	}
+	if current == "" {
+		return fmt.Errorf("template was not opened with OpenFile")
+	}
+	child, err := openPackage(current)
+	if err != nil {
+		return err
+	}
+	defer child.Close()
+
+	basePath := r.includePath(name)
+	base, err := openPackage(basePath)
+	if err != nil {
+		return err
+	}
+	defer base.Close()
+
+	content, err := readPackageXML(&base.Reader, "content.xml")
+	if err != nil {
+		return err
+	}
+	if content.Root().FindElement("office:body/office:text") == nil {
+		return fmt.Errorf("document has no text body")
+	}
+
+	sections := map[string]*etree.Element{}
+	for _, section := range content.Root().FindElements("office:body/office:text//text:section") {
+		sections[section.SelectAttrValue("text:name", "")] = section
+	}
+	overrides := doc.Root().FindElements("office:body/office:text/text:section")
+	for _, section := range overrides {
+		if name := section.SelectAttrValue("text:name", ""); sections[name] == nil {
+			return fmt.Errorf("section %s does not exist in the base template", name)
+		}
+	}
+
+	removeUnusedStyles(doc.Root(), overrides)
+	importAutomaticStyles(content.Root(), doc.Root(), blockPrefix, overrides)
+	for _, section := range overrides {
+		if err := r.importBlockPictures(&child.Reader, section); err != nil {
+			return err
+		}
+	}
+	if err := r.importCommonStyles(&child.Reader, &base.Reader); err != nil {
+		return err
+	}
+
+	for _, section := range overrides {
+		old := sections[section.SelectAttrValue("text:name", "")]
+		parent := old.Parent()
+		index := old.Index()
+		parent.RemoveChildAt(index)
+		parent.InsertChildAt(index, section)
+	}
+
+	doc.SetRoot(content.Root())
+	r.basePackage = basePath
+	return nil
+}
+
+// removeUnusedStyles removes the automatic styles of root that are not used
+// by content, directly or through other styles.
+func removeUnusedStyles(root *etree.Element, content []*etree.Element) {
+	automatic := root.SelectElement("office:automatic-styles")
+	if automatic == nil {
+		return
+	}
+
+	used := map[string]bool{}
+	for _, e := range content {
+		styleReferences(e, used)
+	}
+	visited := map[string]bool{}
+	for changed := true; changed; {
+		changed = false
+		for _, style := range automatic.ChildElements() {
+			name := style.SelectAttrValue("style:name", "")
+			if !used[name] || visited[name] {
+				continue
+			}
+			visited[name] = true
+			styleReferences(style, used)
+			changed = true
+		}
+	}
+
+	for _, style := range automatic.ChildElements() {
+		if !used[style.SelectAttrValue("style:name", "")] {
+			automatic.RemoveChild(style)
+		}
+	}
+}
+
+// styleReferences adds the names in the style name attributes of e and its
+// descendants to names.
+func styleReferences(e *etree.Element, names map[string]bool) {
+	for _, element := range append([]*etree.Element{e}, e.FindElements(".//*")...) {
+		for _, attr := range element.Attr {
+			if key := attr.FullKey(); key != "style:name" && strings.HasSuffix(key, "style-name") {
+				names[attr.Value] = true
+			}
+		}
+	}
+}
+
+// importBlockPictures registers the pictures referenced by an overriding
+// section that are not yet part of the written package.
+func (r *Replacer) importBlockPictures(zr *zip.Reader, section *etree.Element) error {
+	for _, image := range section.FindElements(".//*[@xlink:href]") {
+		href := image.SelectAttrValue("xlink:href", "")
+		if !strings.HasPrefix(href, "Pictures/") {
+			continue
+		}
+		if _, ok := r.file(href); ok {
+			continue
+		}
+		data, err := readPackageFile(zr, href)
+		if err != nil {
+			return err
+		}
+		image.CreateAttr("xlink:href", r.AddFile("Pictures/"+blockPrefix+path.Base(href), data, pictureMediaType(href)))
+	}
+	return nil
+}
+
+// importCommonStyles adds the common styles and fonts of the template that
+// are missing in the base template to the styles.xml of the base template.
+func (r *Replacer) importCommonStyles(child, base *zip.Reader) error {
+	childStyles, err := r.packageStyles(child)
+	if err != nil {
+		return err
+	}
+	baseStyles, err := readPackageXML(base, "styles.xml")
+	if err != nil {
+		return err
+	}
+	if !addCommonStyles(baseStyles, childStyles) {
+		return nil
+	}
+	return r.writeStyles(baseStyles)
+}
+
+// packageStyles returns the styles.xml of the written package: the one
+// registered with AddFile, or the one of the package zr.
+func (r *Replacer) packageStyles(zr *zip.Reader) (*etree.Document, error) {
+	data, ok := r.file("styles.xml")
+	if !ok {
+		return readPackageXML(zr, "styles.xml")
+	}
+	styles := etree.NewDocument()
+	if err := styles.ReadFromBytes(data); err != nil {
+		return nil, fmt.Errorf("failed to parse styles.xml: %w", err)
+	}
+	return styles, nil
+}
+
+// writeStyles registers styles as the styles.xml of the written package.
+func (r *Replacer) writeStyles(styles *etree.Document) error {
+	data, err := styles.WriteToBytes()
+	if err != nil {
+		return fmt.Errorf("failed to write styles.xml: %w", err)
+	}
+	r.AddFile("styles.xml", data, "text/xml")
+	return nil
+}
+
+// addCommonStyles adds the common styles of source missing in target to
+// target, along with the fonts of source. It reports whether any style was
+// added.
+func addCommonStyles(target, source *etree.Document) bool {
+	from := source.Root().SelectElement("office:styles")
+	to := target.Root().SelectElement("office:styles")
+	if from == nil || to == nil {
+		return false
+	}
+
+	existing := map[string]bool{}
+	for _, style := range to.ChildElements() {
+		existing[commonStyleKey(style)] = true
+	}
+	added := false
+	for _, style := range from.ChildElements() {
+		key := commonStyleKey(style)
+		if style.SelectAttrValue("style:name", "") == "" || existing[key] {
+			continue
+		}
+		to.AddChild(style.Copy())
+		existing[key] = true
+		added = true
+	}
+	if !added {
+		return false
+	}
+
+	if fonts := source.Root().SelectElement("office:font-face-decls"); fonts != nil {
+		addFontFaces(target.Root(), fonts)
+	}
+	return true
+}
+
+// commonStyleKey identifies a common style by its kind, family and name.
+func commonStyleKey(style *etree.Element) string {
+	return style.FullTag() + "/" + style.SelectAttrValue("style:family", "") + "/" + style.SelectAttrValue("style:name", "")
+}
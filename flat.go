@@ -0,0 +1,512 @@
+package godtemplate
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/beevik/etree"
+)
+
+// flatExtensions maps the extensions of flat XML documents to the extension
+// of the package format.
+var flatExtensions = map[string]string{
+	".fodt": ".odt",
+	".fods": ".ods",
+	".fodp": ".odp",
+	".fodg": ".odg",
+}
+
+// binaryDataElements can hold their file as office:binary-data in a flat
+// XML document instead of referencing it with xlink:href.
+var binaryDataElements = map[string]bool{
+	"draw:image":                  true,
+	"draw:fill-image":             true,
+	"style:background-image":      true,
+	"text:list-level-style-image": true,
+}
+
+// pictureExtensions are the file extensions of embedded pictures by media
+// type.
+var pictureExtensions = map[string]string{
+	"image/png":     ".png",
+	"image/jpeg":    ".jpg",
+	"image/gif":     ".gif",
+	"image/bmp":     ".bmp",
+	"image/webp":    ".webp",
+	"image/tiff":    ".tif",
+	"image/svg+xml": ".svg",
+}
+
+// IsFlatFile reports whether name is a flat XML document (.fodt, .fods,
+// .fodp or .fodg) by its extension.
+func IsFlatFile(name string) bool {
+	_, ok := flatExtensions[strings.ToLower(filepath.Ext(name))]
+	return ok
+}
+
+// ConvertFlat converts between the package (.odt) and flat XML (.fodt)
+// format of a document, as selected by the extensions of input and output.
+// Pictures are embedded as base64 data in flat documents and stored under
+// Pictures/ in packages. Thumbnails and configuration files of packages are
+// not part of flat documents and get lost.
+func ConvertFlat(input, output string) error {
+	data, err := os.ReadFile(input)
+	if err != nil {
+		return err
+	}
+	switch {
+	case IsFlatFile(input) && !IsFlatFile(output):
+		data, err = UnflattenDocument(data)
+	case !IsFlatFile(input) && IsFlatFile(output):
+		data, err = FlattenPackage(data)
+	case IsFlatFile(input):
+		// normalize the flat document through its package
+		if data, err = UnflattenDocument(data); err == nil {
+			data, err = FlattenPackage(data)
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("failed to convert %s: %w", input, err)
+	}
+	return os.WriteFile(output, data, 0o644)
+}
+
+// openPackage opens a package like zip.OpenReader. A flat XML document is
+// converted into a package in a temporary file first.
+func openPackage(name string) (*zip.ReadCloser, error) {
+	if !IsFlatFile(name) {
+		return zip.OpenReader(name)
+	}
+
+	flat, err := os.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+	data, err := UnflattenDocument(flat)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", name, err)
+	}
+	temp, err := os.CreateTemp("", "godtemplate-*"+flatExtensions[strings.ToLower(filepath.Ext(name))])
+	if err != nil {
+		return nil, err
+	}
+	// the opened package stays readable after the file is removed
+	defer os.Remove(temp.Name())
+	_, err = temp.Write(data)
+	if closeErr := temp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return nil, err
+	}
+	return zip.OpenReader(temp.Name())
+}
+
+// FlattenPackage converts a document package (.odt) into a flat XML document
+// (.fodt). content.xml, styles.xml, meta.xml and settings.xml are combined
+// into one office:document; pictures are embedded as office:binary-data.
+func FlattenPackage(data []byte) ([]byte, error) {
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, err
+	}
+
+	flat := etree.NewDocument()
+	flat.CreateProcInst("xml", `version="1.0" encoding="UTF-8"`)
+	flat.CreateCharData("\n")
+	root := flat.CreateElement("office:document")
+
+	parts := map[string]*etree.Element{}
+	for _, name := range []string{"content.xml", "styles.xml", "meta.xml", "settings.xml"} {
+		if !hasPackageFile(zr, name) {
+			continue
+		}
+		doc, err := readPackageXML(zr, name)
+		if err != nil {
+			return nil, err
+		}
+		if doc.Root() == nil {
+			return nil, fmt.Errorf("%s is empty", name)
+		}
+		if err := embedPictures(zr, doc.Root()); err != nil {
+			return nil, err
+		}
+		parts[name] = doc.Root()
+		for _, attr := range doc.Root().Attr {
+			if (attr.Space == "xmlns" || attr.Key == "xmlns") && root.SelectAttr(attr.FullKey()) == nil {
+				root.CreateAttr(attr.FullKey(), attr.Value)
+			}
+		}
+	}
+	content := parts["content.xml"]
+	if content == nil {
+		return nil, fmt.Errorf("content.xml not found")
+	}
+	if version := content.SelectAttrValue("office:version", ""); version != "" {
+		root.CreateAttr("office:version", version)
+	}
+	mimeType := "application/vnd.oasis.opendocument.text"
+	if data, err := readPackageFile(zr, "mimetype"); err == nil {
+		mimeType = strings.TrimSpace(string(data))
+	}
+	root.CreateAttr("office:mimetype", mimeType)
+
+	styles := parts["styles.xml"]
+	if styles != nil {
+		mergeStyleAutomaticStyles(content, styles)
+	}
+
+	add := func(part *etree.Element, tag string) {
+		if part == nil {
+			return
+		}
+		if e := part.SelectElement(tag); e != nil {
+			root.AddChild(e)
+		}
+	}
+	add(parts["meta.xml"], "office:meta")
+	add(parts["settings.xml"], "office:settings")
+	add(content, "office:scripts")
+	if styles != nil {
+		if fonts := content.SelectElement("office:font-face-decls"); fonts != nil {
+			addFontFaces(styles, fonts)
+		}
+		add(styles, "office:font-face-decls")
+	} else {
+		add(content, "office:font-face-decls")
+	}
+	add(styles, "office:styles")
+	add(content, "office:automatic-styles")
+	add(styles, "office:master-styles")
+	add(content, "office:body")
+
+	indentFlat(root, 0, " ")
+	return flat.WriteToBytes()
+}
+
+// mergeStyleAutomaticStyles moves the automatic styles of styles.xml into the
+// automatic styles of content.xml. Styles of styles.xml with the name of a
+// different style of content.xml are renamed, also in the master pages.
+func mergeStyleAutomaticStyles(content, styles *etree.Element) {
+	source := styles.SelectElement("office:automatic-styles")
+	if source == nil {
+		return
+	}
+	target := automaticStyles(content)
+	existing := map[string]*etree.Element{}
+	for _, style := range target.ChildElements() {
+		existing[style.SelectAttrValue("style:name", "")] = style
+	}
+	names := automaticStyleNames(content)
+
+	renamed := map[string]string{}
+	moved := []*etree.Element{}
+	for _, style := range source.ChildElements() {
+		name := style.SelectAttrValue("style:name", "")
+		if other, ok := existing[name]; ok {
+			if sameElement(style, other) {
+				continue
+			}
+			renamed[name] = uniqueStyleName(name, names)
+			names[renamed[name]] = true
+		}
+		moved = append(moved, style)
+	}
+	for _, style := range moved {
+		renameStyles(style, renamed)
+		target.AddChild(style)
+	}
+	if masters := styles.SelectElement("office:master-styles"); masters != nil && len(renamed) > 0 {
+		renameStyles(masters, renamed)
+	}
+}
+
+func hasPackageFile(zr *zip.Reader, name string) bool {
+	for _, f := range zr.File {
+		if f.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// sameElement reports whether a and b are serialized identically.
+func sameElement(a, b *etree.Element) bool {
+	docA, docB := etree.NewDocument(), etree.NewDocument()
+	docA.SetRoot(a.Copy())
+	docB.SetRoot(b.Copy())
+	textA, _ := docA.WriteToString()
+	textB, _ := docB.WriteToString()
+	return textA == textB
+}
+
+// embedPictures replaces the references to files of the package by their
+// content as office:binary-data.
+func embedPictures(zr *zip.Reader, root *etree.Element) error {
+	for _, e := range root.FindElements("//*[@xlink:href]") {
+		href := e.SelectAttrValue("xlink:href", "")
+		name := strings.TrimPrefix(href, "./")
+		if strings.Contains(name, ":") || strings.HasPrefix(name, "../") || strings.HasPrefix(name, "#") {
+			continue
+		}
+		if !binaryDataElements[e.FullTag()] {
+			if e.FullTag() == "draw:object" || e.FullTag() == "draw:object-ole" {
+				return fmt.Errorf("embedded object %s is not supported in flat documents", href)
+			}
+			continue
+		}
+		data, err := readPackageFile(zr, name)
+		if err != nil {
+			return err
+		}
+		for _, attr := range []string{"xlink:href", "xlink:type", "xlink:show", "xlink:actuate"} {
+			e.RemoveAttr(attr)
+		}
+		binary := etree.NewElement("office:binary-data")
+		binary.SetText(wrapBase64(base64.StdEncoding.EncodeToString(data)))
+		e.InsertChildAt(0, binary)
+	}
+	return nil
+}
+
+// wrapBase64 breaks base64 data into lines of 76 characters.
+func wrapBase64(data string) string {
+	var sb strings.Builder
+	for len(data) > 76 {
+		sb.WriteString(data[:76])
+		sb.WriteString("\n")
+		data = data[76:]
+	}
+	sb.WriteString(data)
+	return sb.String()
+}
+
+// UnflattenDocument converts a flat XML document (.fodt) into a document
+// package (.odt). Embedded pictures are stored as Pictures/<sha1>.<ext>.
+func UnflattenDocument(data []byte) ([]byte, error) {
+	flat := etree.NewDocument()
+	if err := flat.ReadFromBytes(data); err != nil {
+		return nil, fmt.Errorf("failed to parse flat document: %w", err)
+	}
+	root := flat.Root()
+	if root == nil || root.FullTag() != "office:document" {
+		return nil, fmt.Errorf("not a flat document: office:document not found")
+	}
+	indentFlat(root, 0, "")
+
+	pictures := map[string][]byte{}
+	for _, binary := range root.FindElements("//office:binary-data") {
+		picture, err := base64.StdEncoding.DecodeString(strings.Join(strings.Fields(binary.Text()), ""))
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode embedded picture: %w", err)
+		}
+		image := binary.Parent()
+		name := "Pictures/" + pictureHash(picture) + pictureExtension(image, picture)
+		pictures[name] = picture
+		image.RemoveChild(binary)
+		image.CreateAttr("xlink:href", name)
+		image.CreateAttr("xlink:type", "simple")
+		if image.FullTag() == "draw:image" {
+			image.CreateAttr("xlink:show", "embed")
+			image.CreateAttr("xlink:actuate", "onLoad")
+		}
+	}
+
+	part := func(tag string, children ...string) *etree.Document {
+		doc := etree.NewDocument()
+		doc.CreateProcInst("xml", `version="1.0" encoding="UTF-8"`)
+		e := doc.CreateElement(tag)
+		for _, attr := range root.Attr {
+			if attr.Space == "xmlns" || attr.Key == "xmlns" || attr.FullKey() == "office:version" {
+				e.CreateAttr(attr.FullKey(), attr.Value)
+			}
+		}
+		for _, child := range children {
+			if c := root.SelectElement(child); c != nil {
+				e.AddChild(c.Copy())
+			}
+		}
+		return doc
+	}
+	content := part("office:document-content", "office:scripts", "office:font-face-decls", "office:automatic-styles", "office:body")
+	styles := part("office:document-styles", "office:font-face-decls", "office:styles", "office:automatic-styles", "office:master-styles")
+	splitAutomaticStyles(content.Root(), styles.Root())
+	files := []struct {
+		name string
+		doc  *etree.Document
+	}{
+		{"content.xml", content},
+		{"styles.xml", styles},
+		{"meta.xml", part("office:document-meta", "office:meta")},
+		{"settings.xml", part("office:document-settings", "office:settings")},
+	}
+
+	mimeType := root.SelectAttrValue("office:mimetype", "application/vnd.oasis.opendocument.text")
+	manifest := etree.NewDocument()
+	manifest.CreateProcInst("xml", `version="1.0" encoding="UTF-8"`)
+	manifestRoot := manifest.CreateElement("manifest:manifest")
+	manifestRoot.CreateAttr("xmlns:manifest", "urn:oasis:names:tc:opendocument:xmlns:manifest:1.0")
+	if version := root.SelectAttrValue("office:version", ""); version != "" {
+		manifestRoot.CreateAttr("manifest:version", version)
+	}
+	addEntry := func(name, mediaType string) {
+		entry := manifestRoot.CreateElement("manifest:file-entry")
+		entry.CreateAttr("manifest:full-path", name)
+		if name == "/" && root.SelectAttrValue("office:version", "") != "" {
+			entry.CreateAttr("manifest:version", root.SelectAttrValue("office:version", ""))
+		}
+		entry.CreateAttr("manifest:media-type", mediaType)
+	}
+	addEntry("/", mimeType)
+
+	buf := new(bytes.Buffer)
+	zw := zip.NewWriter(buf)
+	writer, err := zw.CreateHeader(&zip.FileHeader{Name: "mimetype", Method: zip.Store})
+	if err != nil {
+		return nil, err
+	}
+	if _, err := writer.Write([]byte(mimeType)); err != nil {
+		return nil, err
+	}
+	write := func(name string, data []byte) error {
+		writer, err := zw.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Deflate})
+		if err != nil {
+			return err
+		}
+		_, err = writer.Write(data)
+		return err
+	}
+
+	for _, f := range files {
+		data, err := f.doc.WriteToBytes()
+		if err != nil {
+			return nil, fmt.Errorf("failed to write %s: %w", f.name, err)
+		}
+		if err := write(f.name, data); err != nil {
+			return nil, err
+		}
+		addEntry(f.name, "text/xml")
+	}
+	names := make([]string, 0, len(pictures))
+	for name := range pictures {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if err := write(name, pictures[name]); err != nil {
+			return nil, err
+		}
+		addEntry(name, pictureMediaType(name))
+	}
+
+	manifestData, err := manifest.WriteToBytes()
+	if err != nil {
+		return nil, fmt.Errorf("failed to write manifest: %w", err)
+	}
+	if err := write("META-INF/manifest.xml", manifestData); err != nil {
+		return nil, err
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// splitAutomaticStyles keeps the page layouts and the automatic styles used
+// by the master pages in styles.xml, and the other automatic styles in
+// content.xml. Both start with all automatic styles of the flat document.
+func splitAutomaticStyles(content, styles *etree.Element) {
+	bodyStyles := usedAutomaticStyles(content, "office:body")
+	masterStyles := usedAutomaticStyles(styles, "office:master-styles")
+
+	if automatic := styles.SelectElement("office:automatic-styles"); automatic != nil {
+		for _, style := range automatic.ChildElements() {
+			if style.FullTag() != "style:page-layout" && !masterStyles[style.SelectAttrValue("style:name", "")] {
+				automatic.RemoveChild(style)
+			}
+		}
+	}
+	if automatic := content.SelectElement("office:automatic-styles"); automatic != nil {
+		for _, style := range automatic.ChildElements() {
+			name := style.SelectAttrValue("style:name", "")
+			if style.FullTag() == "style:page-layout" || (masterStyles[name] && !bodyStyles[name]) {
+				automatic.RemoveChild(style)
+			}
+		}
+	}
+}
+
+// usedAutomaticStyles returns the names of the automatic styles of root that
+// are used by its child tag, directly or through other styles.
+func usedAutomaticStyles(root *etree.Element, tag string) map[string]bool {
+	used := map[string]bool{}
+	if root.SelectElement(tag) == nil || root.SelectElement("office:automatic-styles") == nil {
+		return used
+	}
+	copied := root.Copy()
+	removeUnusedStyles(copied, []*etree.Element{copied.SelectElement(tag)})
+	for _, style := range copied.SelectElement("office:automatic-styles").ChildElements() {
+		used[style.SelectAttrValue("style:name", "")] = true
+	}
+	return used
+}
+
+// pictureExtension returns the file extension of an embedded picture by the
+// media type of its element or by its content.
+func pictureExtension(image *etree.Element, data []byte) string {
+	mediaType := image.SelectAttrValue("draw:mime-type", image.SelectAttrValue("loext:mime-type", ""))
+	if mediaType == "" {
+		mediaType = detectPictureType(data)
+	}
+	return pictureExtensions[mediaType]
+}
+
+// detectPictureType returns the media type of a picture by its content.
+func detectPictureType(data []byte) string {
+	mediaType, _, _ := strings.Cut(http.DetectContentType(data), ";")
+	if strings.HasPrefix(mediaType, "text/") && bytes.Contains(data[:min(len(data), 1024)], []byte("<svg")) {
+		mediaType = "image/svg+xml"
+	}
+	return mediaType
+}
+
+// indentFlat indents the elements of a flat document that contain nothing
+// but child elements, so it can be reviewed and diffed line by line. Only the
+// white space between their child elements is replaced, which is the
+// indentation itself. Paragraphs, headings and elements with text are kept as
+// they are, also if the text is white space like the separator of
+// <number:text> </number:text>. An empty indent removes the indentation again.
+func indentFlat(e *etree.Element, depth int, indent string) {
+	if e.FullTag() == "text:p" || e.FullTag() == "text:h" {
+		return
+	}
+	children := e.ChildElements()
+	if len(children) == 0 {
+		return
+	}
+	for _, token := range e.Child {
+		if data, ok := token.(*etree.CharData); ok && !data.IsWhitespace() {
+			return
+		}
+	}
+	for len(e.Child) > 0 {
+		e.RemoveChildAt(0)
+	}
+	for _, child := range children {
+		if indent != "" {
+			e.CreateCharData("\n" + strings.Repeat(indent, depth+1))
+		}
+		e.AddChild(child)
+		indentFlat(child, depth+1, indent)
+	}
+	if indent != "" && len(children) > 0 {
+		e.CreateCharData("\n" + strings.Repeat(indent, depth))
+	}
+}
@@ -0,0 +1,51 @@
+package godtemplate
+
+import (
+	"archive/zip"
+	"bytes"
+	"strings"
+	"testing"
+)
+
+const flatDataStyle = `<number:currency-style style:name="N108P0"><number:currency-symbol>€</number:currency-symbol><number:text> </number:text><number:number number:decimal-places="2"/></number:currency-style>`
+
+func TestFlatRoundTripKeepsWhiteSpace(t *testing.T) {
+	flat := `<?xml version="1.0" encoding="UTF-8"?>
+<office:document xmlns:office="urn:oasis:names:tc:opendocument:xmlns:office:1.0" xmlns:style="urn:oasis:names:tc:opendocument:xmlns:style:1.0" xmlns:text="urn:oasis:names:tc:opendocument:xmlns:text:1.0" xmlns:number="urn:oasis:names:tc:opendocument:xmlns:datastyle:1.0" office:version="1.3" office:mimetype="application/vnd.oasis.opendocument.text">` +
+		`<office:styles>` + flatDataStyle + `</office:styles>` +
+		`<office:body><office:text><text:p>Total: <text:span> </text:span>42</text:p></office:text></office:body></office:document>`
+
+	data, err := UnflattenDocument([]byte(flat))
+	if err != nil {
+		t.Fatal(err)
+	}
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	styles, err := readPackageFile(zr, "styles.xml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(styles), "<number:text> </number:text>") {
+		t.Errorf("styles.xml lost the white space of the data style:\n%s", styles)
+	}
+	content, err := readPackageFile(zr, "content.xml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(content), "Total: <text:span> </text:span>42") {
+		t.Errorf("content.xml lost the white space of the paragraph:\n%s", content)
+	}
+
+	again, err := FlattenPackage(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(again), "<number:text> </number:text>") {
+		t.Errorf("flat document lost the white space of the data style:\n%s", again)
+	}
+	if !strings.Contains(string(again), "Total: <text:span> </text:span>42") {
+		t.Errorf("flat document lost the white space of the paragraph:\n%s", again)
+	}
+}
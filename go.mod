@@ -4,6 +4,7 @@ go 1.24.1
 
 require (
 	github.com/beevik/etree v1.5.1
+	github.com/boombuler/barcode v1.1.0
 	github.com/sirupsen/logrus v1.9.3
 	github.com/spf13/cobra v1.9.1
 )
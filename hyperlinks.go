@@ -0,0 +1,73 @@
+package godtemplate
+
+import (
+	"net/url"
+	"regexp"
+	"strings"
+
+	"github.com/beevik/etree"
+)
+
+// hyperlinkPattern matches placeholders in link targets, e.g. $PAYMENTURL or
+// the $DOCUMENTNUMBER of https://pay.example.com/$DOCUMENTNUMBER, also with
+// the dollar sign escaped as %24
+var hyperlinkPattern = regexp.MustCompile(`(?:\$|%24)([A-Za-z0-9_]+)`)
+
+// ReplaceHyperlinks replaces placeholders in the targets (xlink:href) of
+// text:a and draw:a elements. A target consisting of a single placeholder is
+// replaced by the value as it is; placeholders embedded in a URL are escaped
+// for their position in it.
+//
+// LibreOffice stores targets typed as "$KEY" as relative path "../$KEY" or
+// with the dollar sign escaped as "%24KEY"; both are recognized. Other escaped
+// dollar signs and placeholders of unknown keys are kept as they are.
+func (r *Replacer) ReplaceHyperlinks(doc *etree.Document, mapping [][2]string) {
+	links := doc.FindElements("//text:a")
+	links = append(links, doc.FindElements("//draw:a")...)
+
+	for _, link := range links {
+		href := link.SelectAttrValue("xlink:href", "")
+		target, ok := hyperlinkTarget(href, mapping)
+		if ok {
+			link.CreateAttr("xlink:href", target)
+		}
+	}
+}
+
+// hyperlinkTarget returns the target with its placeholders replaced and
+// whether any placeholder was found.
+func hyperlinkTarget(href string, mapping [][2]string) (string, bool) {
+	if !hyperlinkPattern.MatchString(href) {
+		return href, false
+	}
+	href = strings.TrimPrefix(href, "../")
+
+	if match := hyperlinkPattern.FindStringSubmatch(href); match != nil && match[0] == href {
+		value, ok := lookupMapping(mapping, match[1])
+		return value, ok
+	}
+
+	found := false
+	indexes := hyperlinkPattern.FindAllStringSubmatchIndex(href, -1)
+	var sb strings.Builder
+	last := 0
+	for _, m := range indexes {
+		sb.WriteString(href[last:m[0]])
+		last = m[1]
+
+		value, ok := lookupMapping(mapping, href[m[2]:m[3]])
+		if !ok {
+			sb.WriteString(href[m[0]:m[1]])
+			continue
+		}
+		found = true
+		switch {
+		case strings.ContainsAny(href[:m[0]], "?#"):
+			sb.WriteString(url.QueryEscape(value))
+		default:
+			sb.WriteString(url.PathEscape(value))
+		}
+	}
+	sb.WriteString(href[last:])
+	return sb.String(), found
+}
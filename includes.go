@@ -0,0 +1,370 @@
+package godtemplate
+
+import (
+	"archive/zip"
+	"bytes"
+	"fmt"
+	"io"
+	"mime"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/beevik/etree"
+)
+
+// includePattern matches paragraphs like "$INCLUDE footer"
+var includePattern = regexp.MustCompile(`^\s*\$INCLUDE\s+(\S+)\s*$`)
+
+// maxIncludeDepth limits nested includes, so cyclic includes fail.
+const maxIncludeDepth = 10
+
+// bodyDeclarations are children of office:text that belong to the document
+// itself and are not included.
+var bodyDeclarations = map[string]bool{
+	"text:sequence-decls":        true,
+	"text:variable-decls":        true,
+	"text:user-field-decls":      true,
+	"text:dde-connection-decls":  true,
+	"text:tracked-changes":       true,
+	"office:forms":               true,
+	"table:calculation-settings": true,
+}
+
+// fragment is the content of an included document, prepared for insertion.
+type fragment struct {
+	body []*etree.Element
+}
+
+// ResolveIncludes replaces paragraphs consisting of "$INCLUDE <name>" by the
+// body content of the document <name>.odt in IncludeDir. The automatic
+// styles, fonts and pictures used by the content are copied along; automatic
+// styles are renamed with the name of the include as prefix, so they do not
+// collide with the styles of the document. Common styles of the included
+// document missing in the document are added to its styles.xml if it was
+// opened with OpenFile. Names of tables, frames and sections are made unique
+// for every inclusion, and xml:id attributes are removed. Included documents
+// may include further documents.
+func (r *Replacer) ResolveIncludes(doc *etree.Document) error {
+	fragments := map[string]*fragment{}
+	names := objectNames(doc.Root())
+	count := 1
+
+	for depth := 0; ; depth++ {
+		paragraphs := includeParagraphs(doc)
+		if len(paragraphs) == 0 {
+			return nil
+		}
+		if depth == maxIncludeDepth {
+			return fmt.Errorf("includes are nested deeper than %d levels", maxIncludeDepth)
+		}
+
+		for _, p := range paragraphs {
+			name := includePattern.FindStringSubmatch(ElementText(p))[1]
+			f, ok := fragments[name]
+			if !ok {
+				var err error
+				f, err = r.loadFragment(doc, name)
+				if err != nil {
+					return fmt.Errorf("failed to include %s: %w", name, err)
+				}
+				fragments[name] = f
+			}
+
+			parent := p.Parent()
+			index := p.Index()
+			parent.RemoveChildAt(index)
+			count++
+			for _, e := range f.body {
+				e = e.Copy()
+				removeXMLIDs(e)
+				renameObjects(e, names, count)
+				parent.InsertChildAt(index, e)
+				index++
+			}
+		}
+	}
+}
+
+func includeParagraphs(doc *etree.Document) []*etree.Element {
+	paragraphs := []*etree.Element{}
+	for _, tag := range []string{"//text:p", "//text:h"} {
+		for _, p := range doc.FindElements(tag) {
+			if includePattern.MatchString(ElementText(p)) {
+				paragraphs = append(paragraphs, p)
+			}
+		}
+	}
+	return paragraphs
+}
+
+// includePath returns the file of an include name.
+func (r *Replacer) includePath(name string) string {
+	if filepath.Ext(name) == "" {
+		name += ".odt"
+	}
+	if filepath.IsAbs(name) {
+		return name
+	}
+	dir := r.IncludeDir
+	if dir == "" {
+		dir = filepath.Dir(r.template)
+	}
+	return filepath.Join(dir, name)
+}
+
+// loadFragment reads an included document and adds its automatic styles,
+// fonts, pictures and missing common styles to doc.
+func (r *Replacer) loadFragment(doc *etree.Document, name string) (*fragment, error) {
+	zr, err := openPackage(r.includePath(name))
+	if err != nil {
+		return nil, err
+	}
+	defer zr.Close()
+
+	content, err := readPackageXML(&zr.Reader, "content.xml")
+	if err != nil {
+		return nil, err
+	}
+	root := content.Root()
+	text := root.FindElement("office:body/office:text")
+	if text == nil {
+		return nil, fmt.Errorf("document has no text body")
+	}
+
+	f := &fragment{}
+	for _, e := range text.ChildElements() {
+		if !bodyDeclarations[e.FullTag()] {
+			f.body = append(f.body, e)
+		}
+	}
+
+	prefix := stylePrefix(name)
+	importAutomaticStyles(doc.Root(), root, prefix, f.body)
+	if err := r.importFragmentStyles(&zr.Reader); err != nil {
+		return nil, err
+	}
+	for _, e := range f.body {
+		err := importPictures(&zr.Reader, e, func(href string, data []byte, mediaType string) string {
+			return r.AddFile("Pictures/"+prefix+path.Base(href), data, mediaType)
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return f, nil
+}
+
+// importFragmentStyles adds the common styles of an included document that
+// are missing in the written package to its styles.xml. Without a template
+// opened with OpenFile there is no package to add them to.
+func (r *Replacer) importFragmentStyles(fragment *zip.Reader) error {
+	current := r.basePackage
+	if current == "" {
+		current = r.template
+	}
+	if current == "" {
+		return nil
+	}
+	host, err := openPackage(current)
+	if err != nil {
+		return err
+	}
+	defer host.Close()
+
+	styles, err := r.packageStyles(&host.Reader)
+	if err != nil {
+		return err
+	}
+	fragmentStyles, err := readPackageXML(fragment, "styles.xml")
+	if err != nil {
+		return err
+	}
+	if !addCommonStyles(styles, fragmentStyles) {
+		return nil
+	}
+	return r.writeStyles(styles)
+}
+
+// importAutomaticStyles copies the automatic styles and font declarations of
+// the document source into target. The styles are renamed with the prefix
+// (avoiding names already used in target), also in the content that is
+// imported along with them. Names already starting with the prefix, e.g.
+// styles imported by an earlier step of a chain of base templates, keep it.
+func importAutomaticStyles(target, source *etree.Element, prefix string, content []*etree.Element) {
+	renamed := map[string]string{}
+	var styles []*etree.Element
+	if automatic := source.SelectElement("office:automatic-styles"); automatic != nil {
+		existing := automaticStyleNames(target)
+		for _, style := range automatic.ChildElements() {
+			old := style.SelectAttrValue("style:name", "")
+			if old == "" {
+				continue
+			}
+			name := old
+			if !strings.HasPrefix(name, prefix) {
+				name = prefix + old
+			}
+			renamed[old] = uniqueStyleName(name, existing)
+			existing[renamed[old]] = true
+			styles = append(styles, style)
+		}
+	}
+
+	for _, style := range styles {
+		renameStyles(style, renamed)
+		automaticStyles(target).AddChild(style)
+	}
+	for _, e := range content {
+		renameStyles(e, renamed)
+	}
+
+	if fonts := source.SelectElement("office:font-face-decls"); fonts != nil {
+		addFontFaces(target, fonts)
+	}
+}
+
+// stylePrefix returns the prefix of style and picture names of an include.
+func stylePrefix(name string) string {
+	name = strings.TrimSuffix(filepath.Base(name), filepath.Ext(name))
+	var sb strings.Builder
+	for i := 0; i < len(name); i++ {
+		if isPlaceholderChar(name[i]) {
+			sb.WriteByte(name[i])
+		}
+	}
+	return sb.String() + "_"
+}
+
+func automaticStyleNames(root *etree.Element) map[string]bool {
+	names := map[string]bool{}
+	if automatic := root.SelectElement("office:automatic-styles"); automatic != nil {
+		for _, style := range automatic.ChildElements() {
+			names[style.SelectAttrValue("style:name", "")] = true
+		}
+	}
+	return names
+}
+
+func uniqueStyleName(name string, existing map[string]bool) string {
+	unique := name
+	for i := 2; existing[unique]; i++ {
+		unique = fmt.Sprintf("%s%d", name, i)
+	}
+	return unique
+}
+
+// automaticStyles returns the office:automatic-styles element of a document,
+// creating it if needed.
+func automaticStyles(root *etree.Element) *etree.Element {
+	if styles := root.SelectElement("office:automatic-styles"); styles != nil {
+		return styles
+	}
+	styles := etree.NewElement("office:automatic-styles")
+	index := len(root.Child)
+	if body := root.SelectElement("office:body"); body != nil {
+		index = body.Index()
+	}
+	root.InsertChildAt(index, styles)
+	return styles
+}
+
+// renameStyles replaces the names of renamed styles in all style name
+// attributes (text:style-name, style:list-style-name, ...) of e and its
+// descendants, and in the style:name of e.
+func renameStyles(e *etree.Element, renamed map[string]string) {
+	elements := append([]*etree.Element{e}, e.FindElements(".//*")...)
+	for _, element := range elements {
+		for i, attr := range element.Attr {
+			key := attr.FullKey()
+			if key != "style:name" && !strings.HasSuffix(key, "style-name") {
+				continue
+			}
+			if name, ok := renamed[attr.Value]; ok {
+				element.Attr[i].Value = name
+			}
+		}
+	}
+}
+
+// addFontFaces adds the font declarations missing in the document.
+func addFontFaces(root, fonts *etree.Element) {
+	decls := root.SelectElement("office:font-face-decls")
+	if decls == nil {
+		decls = etree.NewElement("office:font-face-decls")
+		index := len(root.Child)
+		if styles := root.SelectElement("office:automatic-styles"); styles != nil {
+			index = styles.Index()
+		}
+		root.InsertChildAt(index, decls)
+	}
+
+	existing := map[string]bool{}
+	for _, font := range decls.ChildElements() {
+		existing[font.SelectAttrValue("style:name", "")] = true
+	}
+	for _, font := range fonts.ChildElements() {
+		name := font.SelectAttrValue("style:name", "")
+		if !existing[name] {
+			decls.AddChild(font.Copy())
+			existing[name] = true
+		}
+	}
+}
+
+// importPictures copies the pictures referenced by e from the package zr
+// with add, which returns the name of the copy.
+func importPictures(zr *zip.Reader, e *etree.Element, add func(href string, data []byte, mediaType string) string) error {
+	for _, image := range e.FindElements(".//*[@xlink:href]") {
+		href := image.SelectAttrValue("xlink:href", "")
+		if !strings.HasPrefix(href, "Pictures/") {
+			continue
+		}
+		data, err := readPackageFile(zr, href)
+		if err != nil {
+			return err
+		}
+		image.CreateAttr("xlink:href", add(href, data, pictureMediaType(href)))
+	}
+	return nil
+}
+
+func pictureMediaType(name string) string {
+	if mediaType := mime.TypeByExtension(path.Ext(name)); mediaType != "" {
+		return mediaType
+	}
+	return "application/octet-stream"
+}
+
+func readPackageFile(zr *zip.Reader, name string) ([]byte, error) {
+	for _, f := range zr.File {
+		if f.Name != name {
+			continue
+		}
+		rc, err := f.Open()
+		if err != nil {
+			return nil, err
+		}
+		defer rc.Close()
+		buf := new(bytes.Buffer)
+		if _, err := io.Copy(buf, rc); err != nil {
+			return nil, err
+		}
+		return buf.Bytes(), nil
+	}
+	return nil, fmt.Errorf("%s not found", name)
+}
+
+func readPackageXML(zr *zip.Reader, name string) (*etree.Document, error) {
+	data, err := readPackageFile(zr, name)
+	if err != nil {
+		return nil, err
+	}
+	doc := etree.NewDocument()
+	if err := doc.ReadFromBytes(data); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", name, err)
+	}
+	return doc, nil
+}
@@ -0,0 +1,141 @@
+package invoicerenderer
+
+import (
+	"fmt"
+	"strings"
+)
+
+const (
+	defaultCharsPerLine        = 60
+	defaultCarriedForwardLabel = "Carried forward"
+	defaultBroughtForwardLabel = "Brought forward"
+)
+
+// CarryOver configures "carried forward" subtotal rows for item tables that
+// span several pages. The layout is only known to LibreOffice, so page breaks
+// are either estimated from the number of text lines per page or given
+// explicitly through BreakBefore (e.g. measured from a previous conversion).
+// At every break a carried forward row is inserted at the bottom of the page,
+// the table is continued in a copy that starts on a new page, and a brought
+// forward row is inserted at its top.
+type CarryOver struct {
+	// FirstPageLines is the number of table lines that fit on the first
+	// page, LinesPerPage the number on all following pages. If
+	// FirstPageLines is 0, LinesPerPage is used for the first page too.
+	FirstPageLines int
+	LinesPerPage   int
+	// CharsPerLine is the number of characters of the description column
+	// that fit on one line; longer descriptions count as several lines.
+	// If 0, defaults to 60.
+	CharsPerLine int
+	// BreakBefore lists the item indexes (starting at 0) that begin a new
+	// page. If set, no estimation takes place.
+	BreakBefore []int
+	// CarriedForwardLabel and BroughtForwardLabel are the texts of the
+	// inserted rows. They default to "Carried forward" and "Brought forward".
+	CarriedForwardLabel string
+	BroughtForwardLabel string
+}
+
+// pageBreaks returns the item indexes before which a page break is expected.
+// A break before the first item of a group is placed before its header row.
+func (c *CarryOver) pageBreaks(groups []itemGroup) (map[int]bool, error) {
+	if c == nil {
+		return nil, nil
+	}
+
+	breaks := map[int]bool{}
+	if len(c.BreakBefore) > 0 {
+		count := len(flattenGroups(groups))
+		for _, index := range c.BreakBefore {
+			if index <= 0 || index >= count {
+				return nil, fmt.Errorf("carry-over break before item %d is out of range", index)
+			}
+			breaks[index] = true
+		}
+		return breaks, nil
+	}
+
+	if c.LinesPerPage <= 0 {
+		return nil, fmt.Errorf("carry-over requires LinesPerPage or BreakBefore")
+	}
+	capacity := c.FirstPageLines
+	if capacity <= 0 {
+		capacity = c.LinesPerPage
+	}
+
+	used := 0
+	index := 0
+	for _, group := range groups {
+		for i, item := range group.Items {
+			lines := c.itemLines(item)
+			if group.Name != "" && i == 0 {
+				lines++ // the header row moves with the first item
+			}
+			if group.Name != "" && i == len(group.Items)-1 {
+				lines++ // the subtotal row stays with the last item
+			}
+			// keep one line free for the carried forward row
+			if index > 0 && used+lines+1 > capacity {
+				breaks[index] = true
+				capacity = c.LinesPerPage
+				used = 1 // brought forward row
+			}
+			used += lines
+			index++
+		}
+	}
+	return breaks, nil
+}
+
+// itemLines estimates the number of lines an item takes in the table.
+func (c *CarryOver) itemLines(item InvoiceItem) int {
+	charsPerLine := c.CharsPerLine
+	if charsPerLine <= 0 {
+		charsPerLine = defaultCharsPerLine
+	}
+
+	lines := 0
+	for _, line := range strings.Split(item.Description, "\n") {
+		lines += 1 + (len([]rune(line))-1)/charsPerLine
+	}
+	return lines
+}
+
+// labels returns the texts of the carried forward and brought forward rows.
+func (c *CarryOver) labels() (string, string) {
+	carried := c.CarriedForwardLabel
+	if carried == "" {
+		carried = defaultCarriedForwardLabel
+	}
+	brought := c.BroughtForwardLabel
+	if brought == "" {
+		brought = defaultBroughtForwardLabel
+	}
+	return carried, brought
+}
+
+// carryOverValues returns a carry-over row with the label in the description
+// column and the amount in the total column.
+func carryOverValues(columns []string, label, amount string) ([]string, error) {
+	labelColumn, amountColumn := -1, -1
+	for i, column := range columns {
+		if isDescriptionColumn(column) {
+			labelColumn = i
+		}
+		if isTotalColumn(column) {
+			amountColumn = i
+		}
+	}
+	if amountColumn == -1 {
+		return nil, fmt.Errorf("carry-over requires a total column")
+	}
+	if labelColumn == -1 {
+		labelColumn = 0
+	}
+
+	values := make([]string, len(columns))
+	values[labelColumn] = label
+	values[amountColumn] = amount
+	return values, nil
+}
@@ -0,0 +1,45 @@
+package invoicerenderer
+
+import (
+	"archive/zip"
+	"fmt"
+
+	"github.com/mheers/godtemplate"
+)
+
+// renderDocx renders an invoice from a Word (.docx) template. Placeholders
+// (also in headers and footers), translations, the item table, additional
+// tables and lists work as in ODT templates. Rich text, hyperlink targets,
+// barcodes, includes and base templates are not supported.
+func renderDocx(r *godtemplate.Replacer, reader *zip.ReadCloser, invoice Invoice, items []InvoiceItem, templateInput, resultOutput string) error {
+	parts, err := r.GetDocxParts(reader)
+	if err != nil {
+		return fmt.Errorf("failed to get document: %w", err)
+	}
+
+	var missing []godtemplate.MissingTranslation
+	reported := map[godtemplate.MissingTranslation]bool{}
+	for _, part := range parts {
+		partMissing, err := r.ReplaceTranslations(part, invoice.Catalog, invoice.Locale)
+		if err != nil {
+			return fmt.Errorf("failed to replace translations: %w", err)
+		}
+		for _, m := range partMissing {
+			if !reported[m] {
+				reported[m] = true
+				missing = append(missing, m)
+			}
+		}
+	}
+	reportMissingTranslations(invoice.MissingTranslations, missing)
+
+	if err := fillInvoice(r, parts[godtemplate.DocxDocumentPart], invoice, items); err != nil {
+		return err
+	}
+
+	mapping := invoice.mapping()
+	for _, part := range parts {
+		r.ReplaceDocxValues(part, mapping)
+	}
+	return r.WriteDocx(templateInput, resultOutput, parts)
+}
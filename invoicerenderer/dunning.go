@@ -0,0 +1,292 @@
+package invoicerenderer
+
+import (
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/mheers/godtemplate"
+)
+
+// DunningLevel is the escalation level of a dunning letter.
+type DunningLevel int
+
+const (
+	FirstReminder  DunningLevel = 1
+	SecondReminder DunningLevel = 2
+	FinalNotice    DunningLevel = 3
+)
+
+// defaultDunningLabels are used for $DOCUMENTTYPE if Dunning.DocumentType is
+// empty.
+var defaultDunningLabels = map[DunningLevel]string{
+	FirstReminder:  "Payment Reminder",
+	SecondReminder: "Second Reminder",
+	FinalNotice:    "Final Notice",
+}
+
+// defaultOverdueTableName is the table filled with the overdue invoices if
+// Dunning.TableName is empty.
+const defaultOverdueTableName = "Overdue"
+
+type Dunning struct {
+	// Level is the escalation level. If 0, FirstReminder is used.
+	Level          DunningLevel
+	Salutation     string
+	Name           string
+	Street         string
+	ZIP            string
+	City           string
+	Telephone      string
+	DocumentType   string
+	DocumentNumber string
+	// DocumentDate is the date of the letter; days overdue and interest
+	// are calculated up to this date. If empty, today is used.
+	DocumentDate   string
+	DateFormat     string
+	CustomerNumber string
+	Currency       string
+	// Fee is the late fee charged with this letter.
+	Fee float64
+	// BaseRate is the base interest rate in percent per year (e.g. the
+	// central bank base rate); InterestSurcharge is added on top of it
+	// (e.g. 9 percentage points for business customers in Germany).
+	// A resulting negative rate is treated as zero.
+	BaseRate          float64
+	InterestSurcharge float64
+	// DueDate is the new payment deadline set by this letter.
+	DueDate      string
+	TableName    string
+	TableColumns []string
+	// BackupRows specifies how many rows at the end of the table should be
+	// backed up and reinserted after inserting new rows. If 0, defaults to 3.
+	BackupRows    int
+	BarcodeFormat string
+	// Locale selects the labels of $t:<key> placeholders from Catalog. The
+	// catalog also provides the document type (dunning.level<n>) if it is
+	// empty.
+	Locale  string
+	Catalog *godtemplate.Catalog `json:"-"`
+	// MissingTranslations is called with the $t:<key> labels of the template
+	// that have no translation for Locale, if there are any.
+	MissingTranslations func([]godtemplate.MissingTranslation) `json:"-"`
+}
+
+// OverdueInvoice is an unpaid invoice listed in a dunning letter.
+type OverdueInvoice struct {
+	DocumentNumber string
+	DocumentDate   string
+	DueDate        string
+	// Amount is the outstanding amount of the invoice.
+	Amount float64
+}
+
+// overdueItem is an overdue invoice with its calculated default interest.
+type overdueItem struct {
+	OverdueInvoice
+	DaysOverdue int
+	Interest    float64
+}
+
+// InterestRate returns the yearly default interest rate in percent.
+func (d Dunning) InterestRate() float64 {
+	return math.Max(0, d.BaseRate+d.InterestSurcharge)
+}
+
+func (d Dunning) formatAmount(value float64) string {
+	return formatCurrency(value, d.Currency)
+}
+
+// RenderDunning renders a reminder or dunning letter. The overdue invoices are
+// inserted into the table Dunning.TableName together with their days overdue
+// and the default interest accrued up to the letter date.
+func RenderDunning(templateInput string, dunning Dunning, overdue []OverdueInvoice, resultOutput string) error {
+	if dunning.Level == 0 {
+		dunning.Level = FirstReminder
+	}
+	label, ok := defaultDunningLabels[dunning.Level]
+	if !ok {
+		return fmt.Errorf("unsupported dunning level: %d", dunning.Level)
+	}
+	if dunning.DocumentType == "" {
+		dunning.DocumentType = label
+		if translated, ok := dunning.Catalog.Lookup(dunning.Locale, fmt.Sprintf("dunning.level%d", dunning.Level)); ok {
+			dunning.DocumentType = translated
+		}
+	}
+	if dunning.TableName == "" {
+		dunning.TableName = defaultOverdueTableName
+	}
+
+	// dates are calendar days in the local time zone
+	now := time.Now()
+	letterDate := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.Local)
+	if dunning.DocumentDate != "" {
+		parsed, err := time.ParseInLocation("2006-01-02", dunning.DocumentDate, time.Local)
+		if err != nil {
+			return fmt.Errorf("invalid document date %s: %w", dunning.DocumentDate, err)
+		}
+		letterDate = parsed
+	}
+
+	items := make([]overdueItem, 0, len(overdue))
+	var outstanding, interest float64
+	for _, invoice := range overdue {
+		item, err := dunning.calculateInterest(invoice, letterDate)
+		if err != nil {
+			return err
+		}
+		items = append(items, item)
+		outstanding += item.Amount
+		interest += item.Interest
+	}
+
+	r := godtemplate.Replacer{
+		BarcodeFormat: godtemplate.BarcodeFormat(dunning.BarcodeFormat),
+	}
+	reader, err := r.OpenFile(templateInput)
+	if err != nil {
+		return fmt.Errorf("failed to open template: %w", err)
+	}
+	defer reader.Close()
+
+	doc, _, err := r.GetDocument(reader)
+	if err != nil {
+		return fmt.Errorf("failed to get document: %w", err)
+	}
+
+	if err := r.ResolveExtends(doc); err != nil {
+		return fmt.Errorf("failed to resolve base template: %w", err)
+	}
+
+	if err := r.ResolveIncludes(doc); err != nil {
+		return fmt.Errorf("failed to resolve includes: %w", err)
+	}
+
+	missing, err := r.ReplaceTranslations(doc, dunning.Catalog, dunning.Locale)
+	if err != nil {
+		return fmt.Errorf("failed to replace translations: %w", err)
+	}
+	reportMissingTranslations(dunning.MissingTranslations, missing)
+
+	table, err := openItemTable(&r, doc, dunning.TableName, dunning.BackupRows, false)
+	if err != nil {
+		return err
+	}
+	columns := resolveOverdueColumns(dunning.TableColumns, table.columns)
+	if columns == nil {
+		return fmt.Errorf("unsupported overdue table column count: %d", table.columns)
+	}
+
+	for pos, item := range items {
+		values, err := dunning.buildOverdueValues(columns, pos, item)
+		if err != nil {
+			return err
+		}
+		if err := table.insertCells(&r, table.row, values); err != nil {
+			return err
+		}
+	}
+
+	table.close(&r)
+
+	mapping := [][2]string{
+		{"salutation", dunning.Salutation},
+		{"name", dunning.Name},
+		{"street", dunning.Street},
+		{"zip", dunning.ZIP},
+		{"city", dunning.City},
+		{"tel", dunning.Telephone},
+		{"documenttype", dunning.DocumentType},
+		{"documentnumber", dunning.DocumentNumber},
+		{"documentdate", formatDate(letterDate.Format("2006-01-02"), dunning.DateFormat)},
+		{"customernumber", dunning.CustomerNumber},
+		{"dunninglevel", fmt.Sprintf("%d", dunning.Level)},
+		{"outstanding", dunning.formatAmount(outstanding)},
+		{"interestrate", fmt.Sprintf("%.2f %%", dunning.InterestRate())},
+		{"interest", dunning.formatAmount(interest)},
+		{"fee", dunning.formatAmount(dunning.Fee)},
+		{"totaldue", dunning.formatAmount(outstanding + interest + dunning.Fee)},
+		{"duedate", formatDate(dunning.DueDate, dunning.DateFormat)},
+	}
+
+	return writeDocument(&r, doc, mapping, templateInput, resultOutput)
+}
+
+// calculateInterest returns the days overdue and the simple default interest
+// of an invoice up to the given date.
+func (d Dunning) calculateInterest(invoice OverdueInvoice, until time.Time) (overdueItem, error) {
+	item := overdueItem{OverdueInvoice: invoice}
+
+	dueDate, err := time.ParseInLocation("2006-01-02", invoice.DueDate, time.Local)
+	if err != nil {
+		return item, fmt.Errorf("invalid due date of invoice %s: %w", invoice.DocumentNumber, err)
+	}
+
+	// rounded, as days around a change of daylight saving time have 23 or
+	// 25 hours
+	days := int(math.Round(until.Sub(dueDate).Hours() / 24))
+	if days < 0 {
+		days = 0
+	}
+	item.DaysOverdue = days
+	interest := invoice.Amount * d.InterestRate() / 100 * float64(days) / 365
+	item.Interest = math.Round(interest*100) / 100
+	return item, nil
+}
+
+func resolveOverdueColumns(configured []string, styleCount int) []string {
+	if len(configured) > 0 {
+		return configured
+	}
+
+	switch styleCount {
+	case 4:
+		return []string{"rechnung", "faellig", "tage", "betrag"}
+	case 5:
+		return []string{"rechnung", "datum", "faellig", "tage", "betrag"}
+	case 6:
+		return []string{"rechnung", "datum", "faellig", "tage", "betrag", "zinsen"}
+	default:
+		return nil
+	}
+}
+
+// buildOverdueValues returns the typed cells of an overdue invoice: dates as
+// date cells, days overdue as float and amounts as currency cells.
+func (d Dunning) buildOverdueValues(columns []string, position int, item overdueItem) ([]godtemplate.CellValue, error) {
+	values := make([]godtemplate.CellValue, 0, len(columns))
+	for _, column := range columns {
+		switch column {
+		case "position", "pos", "nr":
+			values = append(values, godtemplate.CellValue{Text: fmt.Sprintf("%d", position+1)})
+		case "rechnung", "invoice", "documentnumber":
+			values = append(values, godtemplate.CellValue{Text: item.DocumentNumber})
+		case "datum", "date", "documentdate":
+			values = append(values, godtemplate.TypedCell(item.DocumentDate, "date", "", formatDate(item.DocumentDate, d.DateFormat)))
+		case "faellig", "duedate":
+			values = append(values, godtemplate.TypedCell(item.DueDate, "date", "", formatDate(item.DueDate, d.DateFormat)))
+		case "tage", "days", "daysoverdue":
+			values = append(values, godtemplate.FloatCell(float64(item.DaysOverdue), fmt.Sprintf("%d", item.DaysOverdue)))
+		case "betrag", "amount":
+			values = append(values, d.amountCell(item.Amount))
+		case "zinsen", "interest":
+			values = append(values, d.amountCell(item.Interest))
+		case "gesamt", "total":
+			values = append(values, d.amountCell(item.Amount+item.Interest))
+		default:
+			return nil, fmt.Errorf("unsupported overdue table column: %s", column)
+		}
+	}
+
+	return values, nil
+}
+
+// amountCell returns the currency cell of an amount.
+func (d Dunning) amountCell(value float64) godtemplate.CellValue {
+	currency := d.Currency
+	if currency == "" {
+		currency = "EUR"
+	}
+	return godtemplate.CurrencyCell(value, currency, d.formatAmount(value))
+}
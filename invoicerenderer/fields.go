@@ -0,0 +1,122 @@
+package invoicerenderer
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/mheers/godtemplate"
+)
+
+// builtinColumns are the table columns filled from the InvoiceItem fields.
+var builtinColumns = map[string]bool{
+	"position": true, "pos": true, "nr": true,
+	"menge": true, "qty": true, "quantity": true,
+	"einheit": true, "unit": true,
+	"text": true, "beschreibung": true, "description": true,
+	"betrag": true, "unitprice": true, "price": true,
+	"gesamt": true, "total": true, "totalprice": true,
+}
+
+// splitColumn splits a column specification like "deliverydate:date" into
+// the column name and its format.
+func splitColumn(column string) (string, string) {
+	name, format, _ := strings.Cut(column, ":")
+	return name, format
+}
+
+// validateColumns returns an error for columns that are neither built in nor
+// present in the Fields of any item. Without items only the built-in columns
+// are known, so custom columns of an empty table are rejected as well.
+func validateColumns(columns []string, items []InvoiceItem) error {
+	for _, column := range columns {
+		name, _ := splitColumn(column)
+		if builtinColumns[name] {
+			continue
+		}
+		found := false
+		for _, item := range items {
+			if _, ok := item.field(name); ok {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return fmt.Errorf("unsupported invoice table column: %s", column)
+		}
+	}
+	return nil
+}
+
+// field returns the custom field of an item, ignoring the case of the key.
+func (i InvoiceItem) field(name string) (any, bool) {
+	if value, ok := i.Fields[name]; ok {
+		return value, true
+	}
+	for key, value := range i.Fields {
+		if strings.EqualFold(key, name) {
+			return value, true
+		}
+	}
+	return nil, false
+}
+
+// itemCell returns the typed table cell of an item column displaying text:
+// quantities as float, prices as currency and custom fields typed by their
+// value and format.
+func (i Invoice) itemCell(item InvoiceItem, column, text string) godtemplate.CellValue {
+	name, format := splitColumn(column)
+	switch name {
+	case "menge", "qty", "quantity":
+		if format != "" {
+			return godtemplate.TypedCell(item.Quantity, format, i.currencyCode(), text)
+		}
+		return godtemplate.FloatCell(float64(item.Quantity), text)
+	case "betrag", "unitprice", "price":
+		if format != "" {
+			return godtemplate.TypedCell(item.UnitPrice, format, i.currencyCode(), text)
+		}
+		return godtemplate.CurrencyCell(item.UnitPrice, i.currencyCode(), text)
+	case "gesamt", "total", "totalprice":
+		if format != "" {
+			return godtemplate.TypedCell(item.TotalPrice, format, i.currencyCode(), text)
+		}
+		return godtemplate.CurrencyCell(item.TotalPrice, i.currencyCode(), text)
+	case "position", "pos", "nr", "einheit", "unit", "text", "beschreibung", "description":
+		return godtemplate.CellValue{Text: text, Rich: format == "markdown"}
+	}
+
+	value, _ := item.field(name)
+	return godtemplate.TypedCell(value, format, i.currencyCode(), text)
+}
+
+// formatField renders a custom field value like godtemplate.FormatValue,
+// except for "amount" and "currency" (with the invoice currency), "words"
+// (in the language of the invoice) and "date" (with the invoice date
+// format).
+func (i Invoice) formatField(value any, format string) (string, error) {
+	if value == nil {
+		return "", nil
+	}
+
+	switch format {
+	case "amount", "currency":
+		number, ok := godtemplate.ToFloat(value)
+		if !ok {
+			return "", fmt.Errorf("cannot format %v as amount", value)
+		}
+		return i.formatAmount(number), nil
+	case "words":
+		number, ok := godtemplate.ToFloat(value)
+		if !ok {
+			return "", fmt.Errorf("cannot format %v as amount in words", value)
+		}
+		return i.amountInWords(number), nil
+	case "date":
+		if t, ok := value.(time.Time); ok {
+			value = t.Format("2006-01-02")
+		}
+		return formatDate(fmt.Sprint(value), i.DateFormat), nil
+	}
+	return godtemplate.FormatValue(value, format)
+}
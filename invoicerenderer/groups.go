@@ -0,0 +1,106 @@
+package invoicerenderer
+
+import (
+	"fmt"
+	"strings"
+)
+
+const defaultSubtotalLabel = "Subtotal"
+
+// itemGroup is a named section of items with its own header and subtotal
+// row. Ungrouped invoices consist of a single group without name.
+type itemGroup struct {
+	Name  string
+	Items []InvoiceItem
+}
+
+// groupItems collects the items by InvoiceItem.Group in the order of the
+// first appearance of each group. Either all or no items must have a group.
+func groupItems(items []InvoiceItem) ([]itemGroup, error) {
+	grouped := 0
+	for _, item := range items {
+		if item.Group != "" {
+			grouped++
+		}
+	}
+	if grouped == 0 {
+		return []itemGroup{{Items: items}}, nil
+	}
+	if grouped != len(items) {
+		return nil, fmt.Errorf("either all or no invoice items must have a group")
+	}
+
+	groups := []itemGroup{}
+	index := map[string]int{}
+	for _, item := range items {
+		i, ok := index[item.Group]
+		if !ok {
+			i = len(groups)
+			index[item.Group] = i
+			groups = append(groups, itemGroup{Name: item.Group})
+		}
+		groups[i].Items = append(groups[i].Items, item)
+	}
+	return groups, nil
+}
+
+// flattenGroups returns the items of all groups in rendering order.
+func flattenGroups(groups []itemGroup) []InvoiceItem {
+	items := []InvoiceItem{}
+	for _, group := range groups {
+		items = append(items, group.Items...)
+	}
+	return items
+}
+
+// groupHeaderValues returns the header row of a group: the group number in
+// the position column and the name in the description column. If the header
+// row has a different number of cells (e.g. a single spanned cell), number
+// and name are placed in its first cell.
+func groupHeaderValues(columns []string, cellCount int, number int, name string) []string {
+	values := make([]string, cellCount)
+	if cellCount != len(columns) {
+		values[0] = fmt.Sprintf("%d %s", number, name)
+		return values
+	}
+
+	for i, column := range columns {
+		if isPositionColumn(column) {
+			values[i] = fmt.Sprintf("%d", number)
+		}
+		if isDescriptionColumn(column) {
+			values[i] = name
+		}
+	}
+	return values
+}
+
+// groupSubtotalValues returns the subtotal row of a group: the label in the
+// description column and the amount in the total column. If the subtotal row
+// has a different number of cells, the label is placed in its first and the
+// amount in its last cell.
+func groupSubtotalValues(columns []string, cellCount int, label, amount string) []string {
+	values := make([]string, cellCount)
+	if cellCount != len(columns) {
+		values[0] = label
+		values[cellCount-1] = amount
+		return values
+	}
+
+	for i, column := range columns {
+		if isDescriptionColumn(column) {
+			values[i] = label
+		}
+		if isTotalColumn(column) {
+			values[i] = amount
+		}
+	}
+	return values
+}
+
+func subtotalLabel(label, group string) string {
+	if label == "" {
+		label = defaultSubtotalLabel
+	}
+	return strings.TrimSpace(label + " " + group)
+}
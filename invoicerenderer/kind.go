@@ -0,0 +1,202 @@
+package invoicerenderer
+
+import (
+	"fmt"
+	"math"
+)
+
+// DocumentKind selects how an invoice document is rendered: it controls the
+// sign of all amounts, the required references and the default label.
+type DocumentKind string
+
+const (
+	KindInvoice               DocumentKind = "invoice"
+	KindCreditNote            DocumentKind = "credit_note"
+	KindCancellation          DocumentKind = "cancellation"
+	KindPartialInvoice        DocumentKind = "partial_invoice"
+	KindFinalInvoice          DocumentKind = "final_invoice"
+	KindAdvancePaymentInvoice DocumentKind = "advance_payment_invoice"
+	KindQuote                 DocumentKind = "quote"
+	KindOrderConfirmation     DocumentKind = "order_confirmation"
+	KindDeliveryNote          DocumentKind = "delivery_note"
+)
+
+// defaultLabels are used for $DOCUMENTTYPE if Invoice.DocumentType is empty.
+var defaultLabels = map[DocumentKind]string{
+	KindInvoice:               "Invoice",
+	KindCreditNote:            "Credit Note",
+	KindCancellation:          "Cancellation Invoice",
+	KindPartialInvoice:        "Partial Invoice",
+	KindFinalInvoice:          "Final Invoice",
+	KindAdvancePaymentInvoice: "Advance Payment Invoice",
+	KindQuote:                 "Quote",
+	KindOrderConfirmation:     "Order Confirmation",
+	KindDeliveryNote:          "Delivery Note",
+}
+
+// priceColumns are the table columns that contain amounts.
+var priceColumns = map[string]bool{
+	"betrag":     true,
+	"unitprice":  true,
+	"price":      true,
+	"gesamt":     true,
+	"total":      true,
+	"totalprice": true,
+}
+
+// AdvancePayment is a previously invoiced advance or partial payment that is
+// deducted from a final invoice.
+type AdvancePayment struct {
+	DocumentNumber string
+	DocumentDate   string
+	Net            float64
+	VAT            float64
+	Total          float64
+}
+
+// DefaultLabel returns the label used for $DOCUMENTTYPE when no explicit
+// DocumentType is set.
+func (k DocumentKind) DefaultLabel() string {
+	return defaultLabels[k]
+}
+
+// IsCorrection reports whether the kind corrects an earlier invoice, which
+// means all amounts are rendered negative.
+func (k DocumentKind) IsCorrection() bool {
+	return k == KindCreditNote || k == KindCancellation
+}
+
+// HasPrices reports whether documents of this kind show prices. Delivery
+// notes list quantities only.
+func (k DocumentKind) HasPrices() bool {
+	return k != KindDeliveryNote
+}
+
+func (k DocumentKind) validate() error {
+	if _, ok := defaultLabels[k]; !ok {
+		return fmt.Errorf("unsupported document kind: %s", k)
+	}
+	return nil
+}
+
+// applyKind validates the invoice against its kind and returns copies of the
+// invoice and items with labels and signs adjusted accordingly.
+func applyKind(invoice Invoice, items []InvoiceItem) (Invoice, []InvoiceItem, error) {
+	if invoice.Kind == "" {
+		invoice.Kind = KindInvoice
+	}
+	if err := invoice.Kind.validate(); err != nil {
+		return invoice, nil, err
+	}
+
+	if invoice.Kind == KindCancellation && invoice.OriginalDocumentNumber == "" {
+		return invoice, nil, fmt.Errorf("a cancellation requires the original document number")
+	}
+	if len(invoice.AdvancePayments) > 0 && invoice.Kind != KindFinalInvoice && invoice.Kind != KindPartialInvoice {
+		return invoice, nil, fmt.Errorf("advance payments can only be deducted by final or partial invoices, not by %s", invoice.Kind)
+	}
+
+	if !invoice.Kind.HasPrices() {
+		for _, column := range invoice.TableColumns {
+			if name, _ := splitColumn(column); priceColumns[name] {
+				return invoice, nil, fmt.Errorf("column %s is not allowed for %s", column, invoice.Kind)
+			}
+		}
+	}
+
+	if invoice.DocumentType == "" {
+		invoice.DocumentType = invoice.Kind.DefaultLabel()
+	}
+
+	adjusted := make([]InvoiceItem, len(items))
+	copy(adjusted, items)
+
+	// corrections are always negative, regardless of whether the caller
+	// already passed negative numbers
+	if invoice.Kind.IsCorrection() {
+		invoice.Net = -math.Abs(invoice.Net)
+		invoice.VAT = -math.Abs(invoice.VAT)
+		invoice.Total = -math.Abs(invoice.Total)
+		for i := range adjusted {
+			adjusted[i].UnitPrice = -math.Abs(adjusted[i].UnitPrice)
+			adjusted[i].TotalPrice = -math.Abs(adjusted[i].TotalPrice)
+		}
+	}
+
+	return invoice, adjusted, nil
+}
+
+// advancePaymentSums returns the summed net, VAT and total of all advance
+// payments.
+func (i Invoice) advancePaymentSums() (net, vat, total float64) {
+	for _, payment := range i.AdvancePayments {
+		net += payment.Net
+		vat += payment.VAT
+		total += payment.Total
+	}
+	return net, vat, total
+}
+
+// AmountDue returns the total minus all deducted advance payments.
+func (i Invoice) AmountDue() float64 {
+	_, _, total := i.advancePaymentSums()
+	return i.Total - total
+}
+
+// ToOrderConfirmation converts a quote into an order confirmation with the
+// same items. The quote number is kept as reference.
+func (i Invoice) ToOrderConfirmation(documentNumber, documentDate string) Invoice {
+	order := i.convert(KindOrderConfirmation, documentNumber, documentDate)
+	order.QuoteNumber = i.DocumentNumber
+	return order
+}
+
+// ToInvoice converts a quote or order confirmation into an invoice with the
+// same items. The order number is kept as reference.
+func (i Invoice) ToInvoice(documentNumber, documentDate string) Invoice {
+	invoice := i.convert(KindInvoice, documentNumber, documentDate)
+	if i.Kind == KindOrderConfirmation {
+		invoice.OrderNumber = i.DocumentNumber
+	}
+	if i.Kind == KindQuote {
+		invoice.QuoteNumber = i.DocumentNumber
+	}
+	return invoice
+}
+
+// ToDeliveryNote converts an order confirmation or invoice into a delivery
+// note. Price columns are removed from the configured table columns.
+func (i Invoice) ToDeliveryNote(documentNumber, documentDate string) Invoice {
+	note := i.convert(KindDeliveryNote, documentNumber, documentDate)
+	if i.Kind == KindOrderConfirmation {
+		note.OrderNumber = i.DocumentNumber
+	}
+
+	if len(i.TableColumns) > 0 {
+		note.TableColumns = make([]string, 0, len(i.TableColumns))
+		for _, column := range i.TableColumns {
+			if name, _ := splitColumn(column); !priceColumns[name] {
+				note.TableColumns = append(note.TableColumns, column)
+			}
+		}
+	}
+	return note
+}
+
+// convert copies the invoice as a document of another kind. State that
+// belongs to the source document only (validity of a quote, deducted advance
+// payments, the corrected invoice, due date and payment link) is reset.
+func (i Invoice) convert(kind DocumentKind, documentNumber, documentDate string) Invoice {
+	converted := i
+	converted.Kind = kind
+	converted.DocumentType = ""
+	converted.DocumentNumber = documentNumber
+	converted.DocumentDate = documentDate
+	converted.ValidUntil = ""
+	converted.AdvancePayments = nil
+	converted.OriginalDocumentNumber = ""
+	converted.OriginalDocumentDate = ""
+	converted.DueDate = ""
+	converted.PaymentURL = ""
+	return converted
+}
@@ -4,8 +4,10 @@ import (
 	"encoding/base64"
 	"encoding/json"
 	"fmt"
+	"strings"
 	"time"
 
+	"github.com/beevik/etree"
 	"github.com/mheers/godtemplate"
 )
 
@@ -41,13 +43,94 @@ type Invoice struct {
 	// BackupRows specifies how many rows at the end of the table should be
 	// backed up and reinserted after inserting new rows. If 0, defaults to 3.
 	BackupRows int
+	// BarcodeFormat selects the image format ("svg" or "png") used for
+	// $barcode:<type>:<KEY> placeholders. If empty, SVG is used.
+	BarcodeFormat string
+	// Kind is the kind of document (invoice, credit note, cancellation, ...).
+	// If empty, KindInvoice is used. If DocumentType is empty, the default
+	// label of the kind is rendered for $DOCUMENTTYPE.
+	Kind DocumentKind
+	// OriginalDocumentNumber and OriginalDocumentDate reference the invoice
+	// corrected by a credit note or cancellation. A cancellation requires
+	// the original document number.
+	OriginalDocumentNumber string
+	OriginalDocumentDate   string
+	// AdvancePayments are deducted from the total of a final or partial
+	// invoice; the remaining amount is rendered as $AMOUNTDUE.
+	AdvancePayments []AdvancePayment
+	// ValidUntil is the date until which a quote is valid.
+	ValidUntil string
+	// DeliveryDate is the (planned) delivery date of an order or delivery.
+	DeliveryDate string
+	// QuoteNumber and OrderNumber reference the quote and order confirmation
+	// a document was converted from.
+	QuoteNumber string
+	OrderNumber string
+	// CarryOver inserts carried forward subtotal rows at the (estimated)
+	// page breaks of the item table. If nil, no such rows are inserted.
+	CarryOver *CarryOver
+	// GroupStyleRows marks the first three backed-up rows of the table as
+	// prototypes for group header, item and group subtotal rows. They are
+	// removed instead of being reinserted, so BackupRows must include them.
+	GroupStyleRows bool
+	// SubtotalLabel precedes the group name in group subtotal rows. If
+	// empty, "Subtotal" is used.
+	SubtotalLabel string
+	// Tables are further tables of the template (tax breakdown, payment
+	// schedule, time sheet, ...) filled by name with their own rows. Values
+	// are formatted like custom item fields unless a table sets Format.
+	Tables []godtemplate.TableData
+	// RowStyles select alternative prototype rows ($rowstyle:<name>) of the
+	// item table for matching items. Items matching no rule alternate
+	// between the odd and even rows, if the table has them.
+	RowStyles []RowStyleRule
+	// Lists are bulleted or numbered lists of the template (terms, included
+	// services, ...) filled from their entries. Values are formatted like
+	// custom item fields unless a list sets Format.
+	Lists []godtemplate.ListData
+	// PaymentURL and PortalURL are the per document links to pay online and
+	// to the customer portal, available as $PAYMENTURL and $PORTALURL, also
+	// as hyperlink targets.
+	PaymentURL string
+	PortalURL  string
+	// Locale selects the labels of $t:<key> placeholders from Catalog, e.g.
+	// "de" or "de-CH". The catalog also provides the document type
+	// (kind.<kind>) and the subtotal and carry-over labels (label.subtotal,
+	// label.carried_forward, label.brought_forward) if they are empty.
+	Locale  string
+	Catalog *godtemplate.Catalog `json:"-"`
+	// MissingTranslations is called with the $t:<key> labels of the template
+	// that have no translation for Locale, if there are any.
+	MissingTranslations func([]godtemplate.MissingTranslation) `json:"-"`
 }
 
 // formatAmount renders a monetary value with the configured currency symbol.
 // An empty currency falls back to the historical default " €" to keep
 // backwards compatibility for callers that do not set Currency.
 func (i Invoice) formatAmount(value float64) string {
-	currency := i.Currency
+	return formatCurrency(value, i.Currency)
+}
+
+// amountInWords writes an amount out in words in the language of Locale, or
+// in English if the language is not supported.
+func (i Invoice) amountInWords(value float64) string {
+	language, _, _ := strings.Cut(strings.ReplaceAll(strings.ToLower(i.Locale), "_", "-"), "-")
+	words, err := godtemplate.AmountInWords(value, i.currencyCode(), language)
+	if err != nil {
+		words, _ = godtemplate.AmountInWords(value, i.currencyCode(), "en")
+	}
+	return words
+}
+
+// currencyCode returns the ISO 4217 code stored in currency cells.
+func (i Invoice) currencyCode() string {
+	if i.Currency == "" {
+		return "EUR"
+	}
+	return i.Currency
+}
+
+func formatCurrency(value float64, currency string) string {
 	if currency == "" {
 		return fmt.Sprintf("%.2f €", value)
 	}
@@ -55,80 +138,234 @@ func (i Invoice) formatAmount(value float64) string {
 }
 
 type InvoiceItem struct {
+	// Group is the name of the section the item belongs to, e.g. a project
+	// phase. Grouped items get a header and subtotal row per group and
+	// hierarchical position numbers (1.1, 1.2, 2.1).
+	Group       string
 	Quantity    int
 	Unit        string
 	Description string
 	UnitPrice   float64
 	TotalPrice  float64
+	// Fields holds additional values (article number, SKU, delivery date,
+	// serial numbers, ...) that can be referenced by name in
+	// Invoice.TableColumns, optionally with a format: "sku",
+	// "deliverydate:date" or "discount:amount".
+	Fields map[string]any
+	// RowStyle selects the prototype row ($rowstyle:<name>) of the item,
+	// taking precedence over Invoice.RowStyles.
+	RowStyle string
 }
 
 func RenderInvoice(templateInput string, invoice Invoice, items []InvoiceItem, resultOutput string) error {
-	r := godtemplate.Replacer{}
+	invoice, items, err := applyKind(invoice.translateLabels(), items)
+	if err != nil {
+		return err
+	}
+
+	r := godtemplate.Replacer{
+		BarcodeFormat: godtemplate.BarcodeFormat(invoice.BarcodeFormat),
+	}
 	reader, err := r.OpenFile(templateInput)
 	if err != nil {
 		return fmt.Errorf("failed to open template: %w", err)
 	}
 	defer reader.Close()
 
+	if godtemplate.IsDocxFile(templateInput) {
+		return renderDocx(&r, reader, invoice, items, templateInput, resultOutput)
+	}
+
 	doc, _, err := r.GetDocument(reader)
 	if err != nil {
 		return fmt.Errorf("failed to get document: %w", err)
 	}
 
-	tableName := invoice.TableName
-	backupRows := invoice.BackupRows
-	if backupRows == 0 {
-		backupRows = 3 // default for backwards compatibility
+	if err := r.ResolveExtends(doc); err != nil {
+		return fmt.Errorf("failed to resolve base template: %w", err)
+	}
+
+	if err := r.ResolveIncludes(doc); err != nil {
+		return fmt.Errorf("failed to resolve includes: %w", err)
+	}
+
+	missing, err := r.ReplaceTranslations(doc, invoice.Catalog, invoice.Locale)
+	if err != nil {
+		return fmt.Errorf("failed to replace translations: %w", err)
+	}
+	reportMissingTranslations(invoice.MissingTranslations, missing)
+
+	if err := fillInvoice(&r, doc, invoice, items); err != nil {
+		return err
+	}
+
+	return writeDocument(&r, doc, invoice.mapping(), templateInput, resultOutput)
+}
+
+// fillInvoice fills the item table, the additional tables and the lists of
+// an invoice document.
+func fillInvoice(r *godtemplate.Replacer, doc *etree.Document, invoice Invoice, items []InvoiceItem) error {
+	writer, err := newRowWriter(r, doc, invoice, items)
+	if err != nil {
+		return err
+	}
+
+	groups, err := groupItems(items)
+	if err != nil {
+		return err
+	}
+
+	breaks, err := invoice.CarryOver.pageBreaks(groups)
+	if err != nil {
+		return err
 	}
-	lastRows := r.BackupLastXRows(r.GetTableElement(doc, tableName), backupRows)
-	table := r.GetTableElement(doc, tableName)
 
-	// get the first row of the lastRows to use as a template for new rows
-	if len(lastRows) == 0 {
-		return fmt.Errorf("no rows found in table %s", tableName)
+	subtotal := 0.0
+	index := 0
+	// pageBreak ends the page with the carried forward subtotal and starts
+	// the next one with the brought forward subtotal
+	pageBreak := func() error {
+		carried, brought := invoice.CarryOver.labels()
+		if err := writer.carryOver(carried, subtotal); err != nil {
+			return err
+		}
+		writer.pageBreak()
+		return writer.carryOver(brought, subtotal)
 	}
-	firstRow := lastRows[0]
-	// -> get the style names from the first row for each column
-	styles := r.GetStylesOfRow(firstRow)
-	columns := resolveColumns(invoice.TableColumns, len(styles))
-	if columns == nil {
-		return fmt.Errorf("unsupported invoice table column count: %d", len(styles))
+	for groupIndex, group := range groups {
+		if group.Name != "" {
+			// the header starts the new page together with the first item
+			if breaks[index] {
+				if err := pageBreak(); err != nil {
+					return err
+				}
+			}
+			if err := writer.groupHeader(groupIndex+1, group.Name); err != nil {
+				return err
+			}
+		}
+
+		groupTotal := 0.0
+		for itemIndex, item := range group.Items {
+			if breaks[index] && (group.Name == "" || itemIndex > 0) {
+				if err := pageBreak(); err != nil {
+					return err
+				}
+			}
+
+			position := fmt.Sprintf("%d", index+1)
+			if group.Name != "" {
+				position = fmt.Sprintf("%d.%d", groupIndex+1, itemIndex+1)
+			}
+			if err := writer.item(position, item); err != nil {
+				return err
+			}
+			subtotal += item.TotalPrice
+			groupTotal += item.TotalPrice
+			index++
+		}
+
+		if group.Name != "" {
+			label := subtotalLabel(invoice.SubtotalLabel, group.Name)
+			if err := writer.groupSubtotal(group.Name, label, groupTotal); err != nil {
+				return err
+			}
+		}
 	}
 
-	for pos, item := range items {
-		values, err := buildTableValues(columns, pos, item, invoice.formatAmount)
-		if err != nil {
+	writer.close()
+
+	for _, table := range invoice.Tables {
+		if table.Format == nil {
+			table.Format = invoice.formatField
+		}
+		if table.Currency == "" {
+			table.Currency = invoice.currencyCode()
+		}
+		if err := r.FillTable(doc, table); err != nil {
 			return err
 		}
-		r.TableInsert(doc, table, values, styles)
 	}
 
-	r.ReinsertRows(table, lastRows)
+	for _, list := range invoice.Lists {
+		if list.Format == nil {
+			list.Format = invoice.formatField
+		}
+		if err := r.FillList(doc, list); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// mapping returns the values of the placeholders of an invoice.
+func (i Invoice) mapping() [][2]string {
+	documentDate := formatDate(i.DocumentDate, i.DateFormat)
+	dueDate := formatDate(i.DueDate, i.DateFormat)
+	originalDocumentDate := formatDate(i.OriginalDocumentDate, i.DateFormat)
+	validUntil := formatDate(i.ValidUntil, i.DateFormat)
+	deliveryDate := formatDate(i.DeliveryDate, i.DateFormat)
+	advanceNet, advanceVAT, advanceTotal := i.advancePaymentSums()
 
-	documentDate := formatDate(invoice.DocumentDate, invoice.DateFormat)
-	dueDate := formatDate(invoice.DueDate, invoice.DateFormat)
+	formatAmount := i.formatAmount
+	amountInWords := i.amountInWords
+	vatRate := fmt.Sprintf("%.2f %%", i.VATRate)
+	if !i.Kind.HasPrices() {
+		formatAmount = func(float64) string { return "" }
+		amountInWords = func(float64) string { return "" }
+		vatRate = ""
+	}
 
-	mapping := [][2]string{
-		{"salutation", invoice.Salutation},
-		{"name", invoice.Name},
-		{"street", invoice.Street},
-		{"zip", invoice.ZIP},
-		{"city", invoice.City},
-		{"tel", invoice.Telephone},
-		{"documenttype", invoice.DocumentType},
-		{"documentnumber", invoice.DocumentNumber},
+	return [][2]string{
+		// replaced before $TOTAL and $AMOUNTDUE, which are their prefixes
+		{"totalinwords", amountInWords(i.Total)},
+		{"amountdueinwords", amountInWords(i.AmountDue())},
+		{"salutation", i.Salutation},
+		{"name", i.Name},
+		{"street", i.Street},
+		{"zip", i.ZIP},
+		{"city", i.City},
+		{"tel", i.Telephone},
+		{"documenttype", i.DocumentType},
+		{"documentnumber", i.DocumentNumber},
 		{"documentdate", documentDate},
-		{"customernumber", invoice.CustomerNumber},
-		{"vatidtext", invoice.VATIDText},
-		{"vatid", invoice.VATID},
-		{"companytext", invoice.CompanyText},
-		{"companyname", invoice.CompanyName},
-		{"vathint", invoice.VATHint},
-		{"net", invoice.formatAmount(invoice.Net)},
-		{"vatrate", fmt.Sprintf("%.2f %%", invoice.VATRate)},
-		{"vat", invoice.formatAmount(invoice.VAT)},
-		{"total", invoice.formatAmount(invoice.Total)},
+		{"customernumber", i.CustomerNumber},
+		{"vatidtext", i.VATIDText},
+		{"vatid", i.VATID},
+		{"companytext", i.CompanyText},
+		{"companyname", i.CompanyName},
+		{"vathint", i.VATHint},
+		{"net", formatAmount(i.Net)},
+		{"vatrate", vatRate},
+		{"vat", formatAmount(i.VAT)},
+		{"total", formatAmount(i.Total)},
 		{"duedate", dueDate},
+		{"originaldocumentnumber", i.OriginalDocumentNumber},
+		{"originaldocumentdate", originalDocumentDate},
+		{"advancepaymentsnet", formatAmount(advanceNet)},
+		{"advancepaymentsvat", formatAmount(advanceVAT)},
+		{"advancepayments", formatAmount(advanceTotal)},
+		{"amountdue", formatAmount(i.AmountDue())},
+		{"validuntil", validUntil},
+		{"deliverydate", deliveryDate},
+		{"quotenumber", i.QuoteNumber},
+		{"ordernumber", i.OrderNumber},
+		{"paymenturl", i.PaymentURL},
+		{"portalurl", i.PortalURL},
+	}
+}
+
+// writeDocument replaces all placeholders of mapping in doc and writes the
+// result into a copy of the template package.
+func writeDocument(r *godtemplate.Replacer, doc *etree.Document, mapping [][2]string, templateInput, resultOutput string) error {
+	if err := r.ReplaceRichText(doc, mapping); err != nil {
+		return fmt.Errorf("failed to replace rich text: %w", err)
+	}
+
+	r.ReplaceHyperlinks(doc, mapping)
+
+	if err := r.ReplaceBarcodes(doc, mapping); err != nil {
+		return fmt.Errorf("failed to replace barcodes: %w", err)
 	}
 
 	xmlContent, err := doc.WriteToString()
@@ -141,11 +378,22 @@ func RenderInvoice(templateInput string, invoice Invoice, items []InvoiceItem, r
 	return r.WriteContent(templateInput, resultOutput, xmlContent)
 }
 
-func resolveColumns(configured []string, styleCount int) []string {
+func resolveColumns(configured []string, styleCount int, kind DocumentKind) []string {
 	if len(configured) > 0 {
 		return configured
 	}
 
+	if !kind.HasPrices() {
+		switch styleCount {
+		case 3:
+			return []string{"menge", "einheit", "text"}
+		case 4:
+			return []string{"position", "menge", "einheit", "text"}
+		default:
+			return nil
+		}
+	}
+
 	switch styleCount {
 	case 4:
 		return []string{"menge", "text", "betrag", "gesamt"}
@@ -158,24 +406,52 @@ func resolveColumns(configured []string, styleCount int) []string {
 	}
 }
 
-func buildTableValues(columns []string, position int, item InvoiceItem, formatAmount func(float64) string) ([]string, error) {
+func buildTableValues(columns []string, position string, item InvoiceItem, invoice Invoice) ([]string, error) {
 	values := make([]string, 0, len(columns))
 	for _, column := range columns {
-		switch column {
-		case "position", "pos", "nr":
-			values = append(values, fmt.Sprintf("%d", position+1))
+		name, format := splitColumn(column)
+		switch name {
+		case "position", "pos", "nr", "einheit", "unit", "text", "beschreibung", "description":
+			if format != "" && format != "markdown" {
+				return nil, fmt.Errorf("unsupported format %s of column %s", format, name)
+			}
+			text := position
+			if name == "einheit" || name == "unit" {
+				text = item.Unit
+			} else if !isPositionColumn(name) {
+				text = item.Description
+			}
+			values = append(values, text)
 		case "menge", "qty", "quantity":
-			values = append(values, fmt.Sprintf("%d", item.Quantity))
-		case "einheit", "unit":
-			values = append(values, item.Unit)
-		case "text", "beschreibung", "description":
-			values = append(values, item.Description)
-		case "betrag", "unitprice", "price":
-			values = append(values, formatAmount(item.UnitPrice))
-		case "gesamt", "total", "totalprice":
-			values = append(values, formatAmount(item.TotalPrice))
+			if format == "" {
+				values = append(values, fmt.Sprintf("%d", item.Quantity))
+				break
+			}
+			formatted, err := invoice.formatField(item.Quantity, format)
+			if err != nil {
+				return nil, fmt.Errorf("failed to format column %s: %w", column, err)
+			}
+			values = append(values, formatted)
+		case "betrag", "unitprice", "price", "gesamt", "total", "totalprice":
+			amount := item.UnitPrice
+			if isTotalColumn(name) {
+				amount = item.TotalPrice
+			}
+			if format == "" {
+				format = "amount"
+			}
+			formatted, err := invoice.formatField(amount, format)
+			if err != nil {
+				return nil, fmt.Errorf("failed to format column %s: %w", column, err)
+			}
+			values = append(values, formatted)
 		default:
-			return nil, fmt.Errorf("unsupported invoice table column: %s", column)
+			value, _ := item.field(name)
+			formatted, err := invoice.formatField(value, format)
+			if err != nil {
+				return nil, fmt.Errorf("failed to format column %s: %w", column, err)
+			}
+			values = append(values, formatted)
 		}
 	}
 
@@ -0,0 +1,297 @@
+package invoicerenderer
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/beevik/etree"
+	"github.com/mheers/godtemplate"
+)
+
+// rowWriter inserts the rows of the item table. Tables with a prototype row
+// ($item.* placeholders) are filled by cloning it, all other tables by
+// cloning the first backed-up row and filling its cells in column order.
+type rowWriter interface {
+	item(position string, item InvoiceItem) error
+	groupHeader(number int, name string) error
+	groupSubtotal(name, label string, amount float64) error
+	carryOver(label string, amount float64) error
+	// pageBreak continues the table in a copy that starts on a new page.
+	pageBreak()
+	close()
+}
+
+func newRowWriter(r *godtemplate.Replacer, doc *etree.Document, invoice Invoice, items []InvoiceItem) (rowWriter, error) {
+	element := r.GetTableElement(doc, invoice.TableName)
+	if element == nil {
+		return nil, fmt.Errorf("table %s not found", invoice.TableName)
+	}
+
+	if prototypes := r.FindPrototypeRows(element, "item"); len(prototypes) > 0 {
+		return newPrototypeWriter(r, element, prototypes, invoice, items)
+	}
+
+	if len(invoice.RowStyles) > 0 || hasRowStyles(items) {
+		return nil, fmt.Errorf("row styles require prototype rows in table %s", invoice.TableName)
+	}
+
+	table, err := openItemTable(r, doc, invoice.TableName, invoice.BackupRows, invoice.GroupStyleRows)
+	if err != nil {
+		return nil, err
+	}
+	columns := resolveColumns(invoice.TableColumns, table.columns, invoice.Kind)
+	if columns == nil {
+		return nil, fmt.Errorf("unsupported invoice table column count: %d", table.columns)
+	}
+	if err := validateColumns(columns, items); err != nil {
+		return nil, err
+	}
+
+	return &columnWriter{r: r, table: table, columns: columns, invoice: invoice}, nil
+}
+
+func hasRowStyles(items []InvoiceItem) bool {
+	for _, item := range items {
+		if item.RowStyle != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// columnWriter fills copies of the template row column by column.
+type columnWriter struct {
+	r       *godtemplate.Replacer
+	table   *itemTable
+	columns []string
+	invoice Invoice
+}
+
+func (w *columnWriter) item(position string, item InvoiceItem) error {
+	values, err := buildTableValues(w.columns, position, item, w.invoice)
+	if err != nil {
+		return err
+	}
+	cells := make([]godtemplate.CellValue, 0, len(values))
+	for i, column := range w.columns {
+		cells = append(cells, w.invoice.itemCell(item, column, values[i]))
+	}
+	return w.table.insertCells(w.r, w.table.row, cells)
+}
+
+func (w *columnWriter) groupHeader(number int, name string) error {
+	values := groupHeaderValues(w.columns, w.table.headerColumns, number, name)
+	return w.table.insertText(w.r, w.table.headerRow, values)
+}
+
+func (w *columnWriter) groupSubtotal(name, label string, amount float64) error {
+	values := groupSubtotalValues(w.columns, w.table.subtotalColumns, label, w.invoice.formatAmount(amount))
+	return w.table.insertText(w.r, w.table.subtotalRow, values)
+}
+
+func (w *columnWriter) carryOver(label string, amount float64) error {
+	values, err := carryOverValues(w.columns, label, w.invoice.formatAmount(amount))
+	if err != nil {
+		return err
+	}
+	return w.table.insert(w.r, values)
+}
+
+func (w *columnWriter) pageBreak() {
+	w.table.element = w.r.SplitTable(w.table.element, nil)
+}
+
+func (w *columnWriter) close() {
+	w.table.close(w.r)
+}
+
+// prototypeWriter clones the prototype row of the table for every item. Rows
+// with $group.* placeholders before and after it are the prototypes for
+// group headers and subtotals; without them the item row is used. Several
+// item rows are told apart by $rowstyle:<name> markers.
+type prototypeWriter struct {
+	r *godtemplate.Replacer
+	// table is the part of the table holding the prototype rows
+	table    *etree.Element
+	styles   godtemplate.RowStyles
+	row      *etree.Element
+	header   *etree.Element
+	subtotal *etree.Element
+	// anchor is the first prototype row; all rows are inserted before it
+	anchor  *etree.Element
+	invoice Invoice
+	fields  map[string]bool
+	// index counts the items of the current group for alternating rows
+	index int
+}
+
+func newPrototypeWriter(r *godtemplate.Replacer, table *etree.Element, prototypes []*etree.Element, invoice Invoice, items []InvoiceItem) (*prototypeWriter, error) {
+	styles, err := r.GetRowStyles(prototypes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read prototype rows of table %s: %w", invoice.TableName, err)
+	}
+	row, err := styles.Default()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read prototype rows of table %s: %w", invoice.TableName, err)
+	}
+
+	w := &prototypeWriter{r: r, table: table, styles: styles, row: row, invoice: invoice, fields: map[string]bool{}}
+	first, last := styles.First(), styles.Last()
+	for _, groupRow := range r.FindPrototypeRows(table, "group") {
+		if groupRow.Parent() != row.Parent() {
+			continue
+		}
+		if groupRow.Index() < first.Index() {
+			w.header = groupRow
+		} else if groupRow.Index() > last.Index() && w.subtotal == nil {
+			w.subtotal = groupRow
+		}
+	}
+	w.anchor = first
+	if w.header != nil {
+		w.anchor = w.header
+	}
+	for _, item := range items {
+		for key := range item.Fields {
+			w.fields[key] = true
+		}
+	}
+	return w, nil
+}
+
+func (w *prototypeWriter) item(position string, item InvoiceItem) error {
+	style, err := w.invoice.rowStyle(item)
+	if err != nil {
+		return err
+	}
+	row, err := w.styles.Select(style, w.index)
+	if err != nil {
+		return fmt.Errorf("failed to fill table %s: %w", w.invoice.TableName, err)
+	}
+	w.index++
+
+	_, err = w.r.InsertPrototypeRowBefore(row, w.anchor, "item", func(key, format string) (godtemplate.CellValue, error) {
+		return w.itemValue(position, item, key, format)
+	})
+	return err
+}
+
+func (w *prototypeWriter) itemValue(position string, item InvoiceItem, key, format string) (godtemplate.CellValue, error) {
+	if !w.invoice.Kind.HasPrices() && priceColumns[key] {
+		return godtemplate.CellValue{}, nil
+	}
+	if !builtinColumns[key] && !w.hasField(key) {
+		return godtemplate.CellValue{}, fmt.Errorf("unsupported item placeholder: $item.%s", key)
+	}
+
+	column := key
+	if format != "" {
+		column += ":" + format
+	}
+	values, err := buildTableValues([]string{column}, position, item, w.invoice)
+	if err != nil {
+		return godtemplate.CellValue{}, err
+	}
+
+	return w.invoice.itemCell(item, column, values[0]), nil
+}
+
+func (w *prototypeWriter) hasField(key string) bool {
+	for field := range w.fields {
+		if strings.EqualFold(field, key) {
+			return true
+		}
+	}
+	return false
+}
+
+func (w *prototypeWriter) groupHeader(number int, name string) error {
+	w.index = 0
+	if w.header != nil {
+		_, err := w.r.InsertPrototypeRowBefore(w.header, w.anchor, "group", func(key, format string) (godtemplate.CellValue, error) {
+			switch key {
+			case "number", "position", "pos", "nr":
+				return godtemplate.FloatCell(float64(number), fmt.Sprintf("%d", number)), nil
+			case "name":
+				return godtemplate.CellValue{Text: name}, nil
+			default:
+				return godtemplate.CellValue{}, fmt.Errorf("unsupported group placeholder: $group.%s", key)
+			}
+		})
+		return err
+	}
+
+	return w.summaryRow(func(key string) godtemplate.CellValue {
+		if isPositionColumn(key) {
+			return godtemplate.FloatCell(float64(number), fmt.Sprintf("%d", number))
+		}
+		if isDescriptionColumn(key) {
+			return godtemplate.CellValue{Text: name}
+		}
+		return godtemplate.CellValue{}
+	})
+}
+
+func (w *prototypeWriter) groupSubtotal(name, label string, amount float64) error {
+	if w.subtotal != nil {
+		_, err := w.r.InsertPrototypeRowBefore(w.subtotal, w.anchor, "group", func(key, format string) (godtemplate.CellValue, error) {
+			switch key {
+			case "name":
+				return godtemplate.CellValue{Text: name}, nil
+			case "label":
+				return godtemplate.CellValue{Text: label}, nil
+			case "total", "subtotal":
+				return w.amountValue(amount), nil
+			default:
+				return godtemplate.CellValue{}, fmt.Errorf("unsupported group placeholder: $group.%s", key)
+			}
+		})
+		return err
+	}
+
+	return w.labelledAmountRow(label, amount)
+}
+
+func (w *prototypeWriter) carryOver(label string, amount float64) error {
+	return w.labelledAmountRow(label, amount)
+}
+
+// labelledAmountRow inserts the item prototype with the label in the
+// description and the amount in the total cell.
+func (w *prototypeWriter) labelledAmountRow(label string, amount float64) error {
+	return w.summaryRow(func(key string) godtemplate.CellValue {
+		if isDescriptionColumn(key) {
+			return godtemplate.CellValue{Text: label}
+		}
+		if isTotalColumn(key) {
+			return w.amountValue(amount)
+		}
+		return godtemplate.CellValue{}
+	})
+}
+
+// summaryRow inserts the item prototype with custom values.
+func (w *prototypeWriter) summaryRow(value func(key string) godtemplate.CellValue) error {
+	_, err := w.r.InsertPrototypeRowBefore(w.row, w.anchor, "item", func(key, format string) (godtemplate.CellValue, error) {
+		return value(key), nil
+	})
+	return err
+}
+
+func (w *prototypeWriter) pageBreak() {
+	w.table = w.r.SplitTable(w.table, w.anchor)
+}
+
+func (w *prototypeWriter) amountValue(amount float64) godtemplate.CellValue {
+	return godtemplate.CurrencyCell(amount, w.invoice.currencyCode(), w.invoice.formatAmount(amount))
+}
+
+func (w *prototypeWriter) close() {
+	w.r.RemoveRowStyles(w.styles)
+	if w.header != nil {
+		w.r.RemoveRow(w.header)
+	}
+	if w.subtotal != nil {
+		w.r.RemoveRow(w.subtotal)
+	}
+}
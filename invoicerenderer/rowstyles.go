@@ -0,0 +1,103 @@
+package invoicerenderer
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/mheers/godtemplate"
+)
+
+// RowStyleRule selects the prototype row ($rowstyle:<Style>) of the items
+// whose Field matches the condition, e.g. {Style: "highlight", Field:
+// "discount", Operator: "gt", Value: 0} or {Style: "free", Field: "total",
+// Value: 0}.
+type RowStyleRule struct {
+	Style string
+	// Field is a built-in column (quantity, unitprice, total, unit,
+	// description) or the name of a custom item field.
+	Field string
+	// Operator is one of "eq" (default), "ne", "lt", "le", "gt", "ge",
+	// "empty" and "notempty". Numbers are compared numerically, all other
+	// values as text.
+	Operator string
+	Value    any
+}
+
+// rowStyle returns the row style of an item: its own RowStyle, or the style of
+// the first matching rule. An empty style lets the table alternate rows.
+func (i Invoice) rowStyle(item InvoiceItem) (string, error) {
+	if item.RowStyle != "" {
+		return item.RowStyle, nil
+	}
+	for _, rule := range i.RowStyles {
+		matches, err := rule.matches(item)
+		if err != nil {
+			return "", err
+		}
+		if matches {
+			return rule.Style, nil
+		}
+	}
+	return "", nil
+}
+
+func (r RowStyleRule) matches(item InvoiceItem) (bool, error) {
+	value, _ := item.value(strings.ToLower(r.Field))
+
+	switch r.Operator {
+	case "empty":
+		return value == nil || fmt.Sprint(value) == "", nil
+	case "notempty":
+		return value != nil && fmt.Sprint(value) != "", nil
+	}
+
+	var cmp int
+	a, aNumber := godtemplate.ToFloat(value)
+	b, bNumber := godtemplate.ToFloat(r.Value)
+	if aNumber && bNumber {
+		switch {
+		case a < b:
+			cmp = -1
+		case a > b:
+			cmp = 1
+		}
+	} else {
+		cmp = strings.Compare(fmt.Sprint(value), fmt.Sprint(r.Value))
+	}
+
+	switch r.Operator {
+	case "", "eq":
+		return cmp == 0, nil
+	case "ne":
+		return cmp != 0, nil
+	case "lt":
+		return cmp < 0, nil
+	case "le":
+		return cmp <= 0, nil
+	case "gt":
+		return cmp > 0, nil
+	case "ge":
+		return cmp >= 0, nil
+	default:
+		return false, fmt.Errorf("unsupported row style operator: %s", r.Operator)
+	}
+}
+
+// value returns a built-in value or custom field of an item by column name.
+func (i InvoiceItem) value(name string) (any, bool) {
+	switch name {
+	case "menge", "qty", "quantity":
+		return i.Quantity, true
+	case "einheit", "unit":
+		return i.Unit, true
+	case "text", "beschreibung", "description":
+		return i.Description, true
+	case "betrag", "unitprice", "price":
+		return i.UnitPrice, true
+	case "gesamt", "total", "totalprice":
+		return i.TotalPrice, true
+	case "group":
+		return i.Group, true
+	}
+	return i.field(name)
+}
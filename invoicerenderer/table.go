@@ -0,0 +1,119 @@
+package invoicerenderer
+
+import (
+	"fmt"
+
+	"github.com/beevik/etree"
+	"github.com/mheers/godtemplate"
+)
+
+// itemTable is a template table prepared for inserting rows. The last rows of
+// the table (e.g. the sums) are backed up and reinserted by close, the first
+// of them is the template row cloned for the inserted rows.
+//
+// If groupStyleRows is set, the first three backed-up rows are templates for
+// group headers, items and group subtotals instead. They are not reinserted.
+type itemTable struct {
+	name        string
+	element     *etree.Element
+	footer      []*etree.Element
+	row         *etree.Element
+	headerRow   *etree.Element
+	subtotalRow *etree.Element
+	// columns, headerColumns and subtotalColumns are the numbers of cells
+	// of the template rows, which are filled with values in this order
+	columns         int
+	headerColumns   int
+	subtotalColumns int
+}
+
+func openItemTable(r *godtemplate.Replacer, doc *etree.Document, name string, backupRows int, groupStyleRows bool) (*itemTable, error) {
+	element := r.GetTableElement(doc, name)
+	if element == nil {
+		return nil, fmt.Errorf("table %s not found", name)
+	}
+
+	if backupRows == 0 {
+		backupRows = 3 // default for backwards compatibility
+	}
+	footer := r.BackupLastXRows(element, backupRows)
+
+	// get the first row of the footer to use as a template for new rows
+	if len(footer) == 0 {
+		return nil, fmt.Errorf("no rows found in table %s", name)
+	}
+
+	if groupStyleRows {
+		if len(footer) < 3 {
+			return nil, fmt.Errorf("table %s needs header, item and subtotal rows for groups", name)
+		}
+		table := &itemTable{
+			name:            name,
+			element:         element,
+			footer:          footer[3:],
+			headerRow:       footer[0],
+			row:             footer[1],
+			subtotalRow:     footer[2],
+			headerColumns:   len(r.RowCells(footer[0])),
+			columns:         len(r.RowCells(footer[1])),
+			subtotalColumns: len(r.RowCells(footer[2])),
+		}
+		if table.headerColumns == 0 || table.subtotalColumns == 0 {
+			return nil, fmt.Errorf("group header and subtotal rows of table %s have no cells", name)
+		}
+		return table, nil
+	}
+
+	columns := len(r.RowCells(footer[0]))
+	return &itemTable{
+		name:            name,
+		element:         element,
+		footer:          footer,
+		row:             footer[0],
+		headerRow:       footer[0],
+		subtotalRow:     footer[0],
+		columns:         columns,
+		headerColumns:   columns,
+		subtotalColumns: columns,
+	}, nil
+}
+
+func (t *itemTable) insert(r *godtemplate.Replacer, values []string) error {
+	return t.insertText(r, t.row, values)
+}
+
+// insertText inserts a copy of the template row with string values.
+func (t *itemTable) insertText(r *godtemplate.Replacer, row *etree.Element, values []string) error {
+	cells := make([]godtemplate.CellValue, 0, len(values))
+	for _, value := range values {
+		cells = append(cells, godtemplate.CellValue{Text: value})
+	}
+	return t.insertCells(r, row, cells)
+}
+
+// insertCells inserts a copy of the template row with typed values.
+func (t *itemTable) insertCells(r *godtemplate.Replacer, row *etree.Element, values []godtemplate.CellValue) error {
+	if _, err := r.TableInsertRow(t.element, row, values); err != nil {
+		return fmt.Errorf("failed to insert row into table %s: %w", t.name, err)
+	}
+	return nil
+}
+
+func isPositionColumn(column string) bool {
+	name, _ := splitColumn(column)
+	return name == "position" || name == "pos" || name == "nr"
+}
+
+func isDescriptionColumn(column string) bool {
+	name, _ := splitColumn(column)
+	return name == "text" || name == "beschreibung" || name == "description"
+}
+
+func isTotalColumn(column string) bool {
+	name, _ := splitColumn(column)
+	return name == "gesamt" || name == "total" || name == "totalprice"
+}
+
+func (t *itemTable) close(r *godtemplate.Replacer) {
+	r.ReinsertRows(t.element, t.footer)
+}
@@ -0,0 +1,42 @@
+package invoicerenderer
+
+import "github.com/mheers/godtemplate"
+
+// translateLabels returns a copy of the invoice with the empty labels filled
+// from the catalog. Labels missing in the catalog stay empty, so the built-in
+// defaults apply.
+func (i Invoice) translateLabels() Invoice {
+	if i.Catalog == nil {
+		return i
+	}
+
+	kind := i.Kind
+	if kind == "" {
+		kind = KindInvoice
+	}
+	if i.DocumentType == "" {
+		i.DocumentType, _ = i.Catalog.Lookup(i.Locale, "kind."+string(kind))
+	}
+	if i.SubtotalLabel == "" {
+		i.SubtotalLabel, _ = i.Catalog.Lookup(i.Locale, "label.subtotal")
+	}
+	if i.CarryOver != nil {
+		carryOver := *i.CarryOver
+		if carryOver.CarriedForwardLabel == "" {
+			carryOver.CarriedForwardLabel, _ = i.Catalog.Lookup(i.Locale, "label.carried_forward")
+		}
+		if carryOver.BroughtForwardLabel == "" {
+			carryOver.BroughtForwardLabel, _ = i.Catalog.Lookup(i.Locale, "label.brought_forward")
+		}
+		i.CarryOver = &carryOver
+	}
+	return i
+}
+
+// reportMissingTranslations passes the labels without translation to report,
+// if both are given.
+func reportMissingTranslations(report func([]godtemplate.MissingTranslation), missing []godtemplate.MissingTranslation) {
+	if report != nil && len(missing) > 0 {
+		report(missing)
+	}
+}
@@ -0,0 +1,219 @@
+package godtemplate
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/beevik/etree"
+)
+
+// ListData is the content of a bulleted or numbered list of the template.
+//
+// The list is marked by a prototype list item with placeholders named after
+// the list, e.g. $services.title and $services.price:number for entries that
+// are maps, or $terms (or $terms.value) for entries that are strings. The
+// item is cloned for every entry and then removed; list style, nesting level
+// and numbering of the surrounding text:list are kept.
+//
+// Entries that are maps may hold nested entries under the key "children".
+// They are rendered as a nested list, using a prototype item in a nested list
+// of the prototype if there is one, else the prototype itself.
+//
+// In Word documents the prototype is the first paragraph with a placeholder
+// of the list; nested entries are copies of it one list level deeper.
+type ListData struct {
+	Name  string
+	Items []any
+	// Format renders a value for a placeholder like $services.price:number.
+	// If nil, FormatValue is used.
+	Format func(value any, format string) (string, error) `json:"-"`
+}
+
+// listPattern matches placeholders like $terms, $terms.value or
+// $services.price:number
+func listPattern(name string) *regexp.Regexp {
+	return regexp.MustCompile(`\$` + regexp.QuoteMeta(name) + `(?:\.([A-Za-z0-9_]+)(?::([A-Za-z]+))?)?\b`)
+}
+
+// FillLists fills all given lists of the document.
+func (r *Replacer) FillLists(doc *etree.Document, lists []ListData) error {
+	for _, list := range lists {
+		if err := r.FillList(doc, list); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// FillList fills a single list of the document with its entries.
+func (r *Replacer) FillList(doc *etree.Document, data ListData) error {
+	format := data.Format
+	if format == nil {
+		format = FormatValue
+	}
+	if isDocx(doc) {
+		return fillDocxList(doc, data, format)
+	}
+
+	pattern := listPattern(data.Name)
+	prototype := findListPrototype(doc.Root(), pattern)
+	if prototype == nil {
+		return fmt.Errorf("list %s not found", data.Name)
+	}
+
+	items, err := buildListItems(prototype, pattern, data.Items, format)
+	if err != nil {
+		return fmt.Errorf("failed to fill list %s: %w", data.Name, err)
+	}
+
+	parent := prototype.Parent()
+	for _, item := range items {
+		parent.InsertChildAt(prototype.Index(), item)
+	}
+	parent.RemoveChild(prototype)
+	return nil
+}
+
+// findListPrototype returns the outermost list item whose own paragraphs
+// contain a placeholder of the list.
+func findListPrototype(root *etree.Element, pattern *regexp.Regexp) *etree.Element {
+	for _, item := range root.FindElements(".//text:list-item") {
+		if ownTextMatches(item, pattern) {
+			return item
+		}
+	}
+	return nil
+}
+
+func ownTextMatches(item *etree.Element, pattern *regexp.Regexp) bool {
+	for _, child := range item.ChildElements() {
+		if child.FullTag() != "text:p" && child.FullTag() != "text:h" {
+			continue
+		}
+		if pattern.MatchString(ElementText(child)) {
+			return true
+		}
+	}
+	return false
+}
+
+// nestedPrototype returns the prototype item of a nested list of the
+// prototype and the nested list containing it.
+func nestedPrototype(prototype *etree.Element, pattern *regexp.Regexp) (*etree.Element, *etree.Element) {
+	for _, list := range prototype.SelectElements("text:list") {
+		for _, item := range list.SelectElements("text:list-item") {
+			if ownTextMatches(item, pattern) {
+				return item, list
+			}
+		}
+	}
+	return nil, nil
+}
+
+func buildListItems(prototype *etree.Element, pattern *regexp.Regexp, entries []any, format func(any, string) (string, error)) ([]*etree.Element, error) {
+	child, childList := nestedPrototype(prototype, pattern)
+
+	items := make([]*etree.Element, 0, len(entries))
+	for i, entry := range entries {
+		item := prototype.Copy()
+		if childList != nil {
+			item.RemoveChildAt(childList.Index())
+		}
+		// only the first item may restart the numbering
+		if i > 0 {
+			item.RemoveAttr("text:start-value")
+		}
+		removeXMLIDs(item)
+
+		err := ReplaceText(item, pattern, func(match []string) (string, error) {
+			value, err := listValue(entry, strings.ToLower(match[1]))
+			if err != nil {
+				return "", err
+			}
+			return format(value, strings.ToLower(match[2]))
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		children := listChildren(entry)
+		if len(children) > 0 {
+			list := etree.NewElement("text:list")
+			childPrototype := prototype
+			if child != nil {
+				list = childList.Copy()
+				for len(list.Child) > 0 {
+					list.RemoveChildAt(0)
+				}
+				list.RemoveAttr("xml:id")
+				childPrototype = child
+			}
+
+			nested, err := buildListItems(childPrototype, pattern, children, format)
+			if err != nil {
+				return nil, err
+			}
+			for _, n := range nested {
+				list.AddChild(n)
+			}
+			item.AddChild(list)
+		}
+
+		items = append(items, item)
+	}
+	return items, nil
+}
+
+// listValue returns the value of a placeholder of a list entry. A placeholder
+// without key references a string entry or the key "value" of a map.
+func listValue(entry any, key string) (any, error) {
+	values, ok := entry.(map[string]any)
+	if !ok {
+		if key != "" && key != "value" {
+			return nil, fmt.Errorf("list entry %v has no key %s", entry, key)
+		}
+		return entry, nil
+	}
+	if key == "" {
+		key = "value"
+	}
+	value, _ := lookupValue(values, key)
+	return value, nil
+}
+
+// listChildren returns the nested entries of a list entry.
+func listChildren(entry any) []any {
+	values, ok := entry.(map[string]any)
+	if !ok {
+		return nil
+	}
+	children, _ := lookupValue(values, "children")
+	switch c := children.(type) {
+	case []any:
+		return c
+	case []string:
+		entries := make([]any, 0, len(c))
+		for _, s := range c {
+			entries = append(entries, s)
+		}
+		return entries
+	case []map[string]any:
+		entries := make([]any, 0, len(c))
+		for _, m := range c {
+			entries = append(entries, m)
+		}
+		return entries
+	default:
+		return nil
+	}
+}
+
+// removeXMLIDs removes the xml:id attributes of an element and its
+// descendants, which must stay unique in copies.
+func removeXMLIDs(e *etree.Element) {
+	e.RemoveAttr("xml:id")
+	for _, child := range e.FindElements(".//*[@xml:id]") {
+		child.RemoveAttr("xml:id")
+	}
+}
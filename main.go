@@ -3,27 +3,55 @@ package godtemplate
 import (
 	"archive/zip"
 	"bytes"
+	"context"
+	"encoding/xml"
 	"fmt"
 	"io"
 	"os"
-	"os/exec"
-	"path/filepath"
 	"regexp"
 	"strings"
 
 	"github.com/beevik/etree"
 )
 
-type Replacer struct{}
+type Replacer struct {
+	// BarcodeFormat selects the image format generated for $barcode
+	// placeholders. If empty, BarcodeSVG is used.
+	BarcodeFormat BarcodeFormat
+
+	// IncludeDir is the directory of the documents referenced by $INCLUDE and
+	// $EXTENDS paragraphs. If empty, the directory of the opened template is used.
+	IncludeDir string
+
+	// template is the file opened with OpenFile.
+	template string
+
+	// basePackage is the package of the base template the document extends
+	// (see ResolveExtends). WriteContent copies its files instead of the
+	// files of the template.
+	basePackage string
+
+	// files holds additional package entries (e.g. generated pictures)
+	// that are written by WriteContent and registered in the manifest.
+	files []packageFile
+}
+
+type packageFile struct {
+	Name      string
+	MediaType string
+	Data      []byte
+}
 
 type TableEntryStyle struct {
 	CellStyle string
 	TextStyle string
 }
 
-// Open the .odt/.zip file
+// Open the .odt/.zip file. Flat XML documents (.fodt) are opened as the
+// equivalent package.
 func (r *Replacer) OpenFile(fileName string) (*zip.ReadCloser, error) {
-	return zip.OpenReader(fileName)
+	r.template = fileName
+	return openPackage(fileName)
 }
 
 // Read and parse content.xml
@@ -55,8 +83,12 @@ func (r *Replacer) GetDocument(zipReader *zip.ReadCloser) (*etree.Document, *zip
 	return doc, contentFile, nil
 }
 
-// Find a table by name
+// Find a table by name. Tables of Word documents are found by their title
+// (alternative text).
 func (r *Replacer) GetTableElement(doc *etree.Document, name string) *etree.Element {
+	if isDocx(doc) {
+		return getDocxTable(doc, name)
+	}
 	tables := doc.FindElements(".//table:table")
 	for _, t := range tables {
 		if t.SelectAttrValue("table:name", "") == name {
@@ -68,11 +100,31 @@ func (r *Replacer) GetTableElement(doc *etree.Document, name string) *etree.Elem
 
 // Create a cell with styled paragraphs
 func (r *Replacer) GetCell(doc *etree.Document, value, tableStyle, textStyle string) *etree.Element {
+	return r.GetTypedCell(doc, CellValue{Text: value}, tableStyle, textStyle)
+}
+
+// GetTypedCell creates a cell displaying the text of value. Cells with a
+// value type (float, currency, percentage, date, time or boolean) also store
+// the raw value, so they can be calculated with. Rich text cells need
+// FinishRichText once they are part of the document.
+func (r *Replacer) GetTypedCell(doc *etree.Document, value CellValue, tableStyle, textStyle string) *etree.Element {
 	cell := doc.CreateElement("table:table-cell")
 	cell.CreateAttr("office:value-type", "string")
 	cell.CreateAttr("table:style-name", tableStyle)
+	setCellValue(cell, value)
+
+	if value.Rich {
+		p := doc.CreateElement("text:p")
+		p.CreateAttr("text:style-name", textStyle)
+		for _, token := range value.tokens() {
+			p.AddChild(token)
+		}
+		cell.AddChild(p)
+		liftRichText(cell)
+		return cell
+	}
 
-	for _, line := range strings.Split(value, "\n") {
+	for _, line := range strings.Split(value.Text, "\n") {
 		p := doc.CreateElement("text:p")
 		p.CreateAttr("text:style-name", textStyle)
 		p.SetText(line)
@@ -91,6 +143,54 @@ func (r *Replacer) TableInsert(doc *etree.Document, tableElement *etree.Element,
 	tableElement.AddChild(row)
 }
 
+// TableInsertValues adds a new row of typed cells to the table.
+func (r *Replacer) TableInsertValues(doc *etree.Document, tableElement *etree.Element, values []CellValue, designValues []TableEntryStyle) error {
+	row := doc.CreateElement("table:table-row")
+	rich := false
+	for i, value := range values {
+		cell := r.GetTypedCell(doc, value, designValues[i].CellStyle, designValues[i].TextStyle)
+		row.AddChild(cell)
+		rich = rich || value.Rich
+	}
+	tableElement.AddChild(row)
+	if rich {
+		return FinishRichText(tableElement)
+	}
+	return nil
+}
+
+// TableInsertRow appends a deep copy of templateRow to the table and fills its
+// cells with values. Row and cell attributes (styles, spans, value types),
+// covered cells and the paragraph and leading span formatting of each cell
+// are kept; cells without value are emptied.
+func (r *Replacer) TableInsertRow(tableElement, templateRow *etree.Element, values []CellValue) (*etree.Element, error) {
+	if templateRow.FullTag() == "w:tr" {
+		return insertDocxRow(tableElement, templateRow, values)
+	}
+	row := templateRow.Copy()
+	cells := r.RowCells(row)
+	if len(values) > len(cells) {
+		return nil, fmt.Errorf("template row has %d cells, but %d values were given", len(cells), len(values))
+	}
+
+	rich := false
+	for i, cell := range cells {
+		value := CellValue{}
+		if i < len(values) {
+			value = values[i]
+		}
+		fillCell(cell, value)
+		rich = rich || value.Rich
+	}
+	tableElement.AddChild(row)
+	if rich {
+		if err := FinishRichText(tableElement); err != nil {
+			return nil, err
+		}
+	}
+	return row, nil
+}
+
 // Backup last X rows from the table
 func (r *Replacer) BackupLastXRows(table *etree.Element, x int) []*etree.Element {
 	children := table.ChildElements()
@@ -111,7 +211,154 @@ func (r *Replacer) ReinsertRows(table *etree.Element, rows []*etree.Element) {
 	}
 }
 
+// SplitTable moves row and all rows after it into a copy of the table that
+// starts on a new page, e.g. to put carried forward rows at the bottom and
+// top of pages. If row is nil, the new table is empty. Columns and repeated
+// header rows are copied. The new table is inserted after the table and
+// returned.
+func (r *Replacer) SplitTable(table, row *etree.Element) *etree.Element {
+	if table.FullTag() == "w:tbl" {
+		return splitDocxTable(table, row)
+	}
+
+	split := table.Copy()
+	for _, child := range split.ChildElements() {
+		switch child.FullTag() {
+		case "table:table-column", "table:table-columns", "table:table-column-group", "table:table-header-columns", "table:table-header-rows":
+		default:
+			split.RemoveChild(child)
+		}
+	}
+	removeXMLIDs(split)
+	split.CreateAttr("table:name", uniqueTableName(table))
+	split.CreateAttr("table:style-name", pageBreakTableStyle(table))
+
+	if row != nil {
+		parent := row.Parent()
+		target := split
+		if parent != table {
+			// rows of a row group stay in a copy of the group
+			target = parent.Copy()
+			for len(target.Child) > 0 {
+				target.RemoveChildAt(0)
+			}
+			split.AddChild(target)
+		}
+		for _, moved := range followingElements(row) {
+			target.AddChild(moved)
+		}
+		if parent != table {
+			for _, moved := range followingElements(parent)[1:] {
+				split.AddChild(moved)
+			}
+		}
+	}
+
+	table.Parent().InsertChildAt(table.Index()+1, split)
+	return split
+}
+
+// followingElements returns e and its following sibling elements.
+func followingElements(e *etree.Element) []*etree.Element {
+	siblings := e.Parent().ChildElements()
+	for i, sibling := range siblings {
+		if sibling == e {
+			return siblings[i:]
+		}
+	}
+	return nil
+}
+
+// splitTableName matches the names of the parts of a split table.
+var splitTableName = regexp.MustCompile(`^(.*)_[0-9]+$`)
+
+// uniqueTableName returns an unused name for a part of a split table, e.g.
+// Listing_2, Listing_3.
+func uniqueTableName(table *etree.Element) string {
+	used := map[string]bool{}
+	for _, t := range documentRoot(table).FindElements(".//table:table") {
+		used[t.SelectAttrValue("table:name", "")] = true
+	}
+	name := table.SelectAttrValue("table:name", "Table")
+	if match := splitTableName.FindStringSubmatch(name); match != nil && used[match[1]] {
+		name = match[1]
+	}
+	for i := 2; ; i++ {
+		candidate := fmt.Sprintf("%s_%d", name, i)
+		if !used[candidate] {
+			return candidate
+		}
+	}
+}
+
+// pageBreakTableStyle returns an automatic table style like the style of
+// table that starts on a new page, creating it if needed.
+func pageBreakTableStyle(table *etree.Element) string {
+	root := documentRoot(table)
+	automatic := root.SelectElement("office:automatic-styles")
+	if automatic == nil {
+		automatic = etree.NewElement("office:automatic-styles")
+		root.InsertChildAt(0, automatic)
+	}
+
+	base := table.SelectAttrValue("table:style-name", "")
+	if strings.HasSuffix(base, "PageBreak") {
+		// a part of a split table
+		return base
+	}
+	name := "TablePageBreak"
+	if base != "" {
+		name = base + "_PageBreak"
+	}
+	for _, style := range automatic.SelectElements("style:style") {
+		if style.SelectAttrValue("style:name", "") == name {
+			return name
+		}
+	}
+
+	var style *etree.Element
+	for _, s := range automatic.SelectElements("style:style") {
+		if s.SelectAttrValue("style:name", "") == base && s.SelectAttrValue("style:family", "") == "table" {
+			style = s.Copy()
+		}
+	}
+	if style == nil {
+		style = etree.NewElement("style:style")
+		style.CreateAttr("style:family", "table")
+	}
+	style.CreateAttr("style:name", name)
+	// a master page would start a new page style, not just a new page
+	style.RemoveAttr("style:master-page-name")
+	properties := style.SelectElement("style:table-properties")
+	if properties == nil {
+		properties = style.CreateElement("style:table-properties")
+	}
+	properties.CreateAttr("fo:break-before", "page")
+	automatic.AddChild(style)
+	return name
+}
+
+// documentRoot returns the root element of the document containing e.
+func documentRoot(e *etree.Element) *etree.Element {
+	for e.Parent() != nil && e.Parent().Parent() != nil {
+		e = e.Parent()
+	}
+	return e
+}
+
+// RowCells returns the cells of a table row in the order TableInsertRow fills
+// them with values.
+func (r *Replacer) RowCells(row *etree.Element) []*etree.Element {
+	if row.FullTag() == "w:tr" {
+		return row.SelectElements("w:tc")
+	}
+	return row.SelectElements("table:table-cell")
+}
+
 func (r *Replacer) GetStylesOfRow(row *etree.Element) []TableEntryStyle {
+	if row.FullTag() == "w:tr" {
+		return getDocxRowStyles(row)
+	}
 	styles := make([]TableEntryStyle, 0, len(row.ChildElements()))
 	for _, cell := range row.ChildElements() {
 		cellStyle := cell.SelectAttrValue("table:style-name", "")
@@ -132,6 +379,14 @@ func (r *Replacer) GetStylesOfRow(row *etree.Element) []TableEntryStyle {
 	return styles
 }
 
+// escapeXMLText escapes text for XML character data and attribute values.
+func escapeXMLText(text string) string {
+	var sb strings.Builder
+	// writing to a strings.Builder does not fail
+	_ = xml.EscapeText(&sb, []byte(text))
+	return sb.String()
+}
+
 func (r *Replacer) CleanXMLTemplate(xml string) string {
 	// translates $<text:span text:style-name="T8">TEXT</text:span> to $TEXT using regex
 	re := regexp.MustCompile(`\$<text:span text:style-name="(.*?)">(.*?)</text:span>`)
@@ -143,7 +398,8 @@ func (r *Replacer) CleanXMLTemplate(xml string) string {
 	return xml
 }
 
-// Replace values in XML string using a key/value mapping
+// Replace values in XML string using a key/value mapping. The values are text
+// and escaped for XML, e.g. the & of URLs with query strings.
 func (r *Replacer) ReplaceValues(xml string, mapping [][2]string) string {
 	xml = r.CleanXMLTemplate(xml)
 	xml = r.NormalizePlaceholderSpans(xml)
@@ -156,7 +412,7 @@ func (r *Replacer) ReplaceValues(xml string, mapping [][2]string) string {
 				edit = fmt.Sprintf("%s.%s.%s", parts[2], parts[1], parts[0])
 			}
 		}
-		xml = strings.ReplaceAll(xml, "$"+strings.ToUpper(key), edit)
+		xml = strings.ReplaceAll(xml, "$"+strings.ToUpper(key), escapeXMLText(edit))
 	}
 	return xml
 }
@@ -242,15 +498,58 @@ func isPlaceholderChar(b byte) bool {
 	return (b >= 'A' && b <= 'Z') || (b >= 'a' && b <= 'z') || (b >= '0' && b <= '9') || b == '_'
 }
 
-// Write new content.xml into a new zip file
+// AddFile registers an additional file (e.g. a picture) that is written into
+// the package by WriteContent. Files with an already registered name are
+// replaced. The returned value is the path to reference from content.xml.
+func (r *Replacer) AddFile(name string, data []byte, mediaType string) string {
+	for i, f := range r.files {
+		if f.Name == name {
+			r.files[i] = packageFile{Name: name, MediaType: mediaType, Data: data}
+			return name
+		}
+	}
+	r.files = append(r.files, packageFile{Name: name, MediaType: mediaType, Data: data})
+	return name
+}
+
+// file returns the data of a file registered through AddFile.
+func (r *Replacer) file(name string) ([]byte, bool) {
+	for _, f := range r.files {
+		if f.Name == name {
+			return f.Data, true
+		}
+	}
+	return nil, false
+}
+
+// Write new content.xml into a new zip file. If the document extends a base
+// template, the other files are copied from the package of the base template
+// instead of srcZipPath. If dstZipPath is a flat XML document (.fodt), the
+// package is written in that format.
 func (r *Replacer) WriteContent(srcZipPath, dstZipPath string, xmlContent string) error {
+	if r.basePackage != "" {
+		srcZipPath = r.basePackage
+	}
+
 	// Read the original file
-	originalZip, err := zip.OpenReader(srcZipPath)
+	originalZip, err := openPackage(srcZipPath)
 	if err != nil {
 		return err
 	}
 	defer originalZip.Close()
 
+	if IsFlatFile(dstZipPath) {
+		buf := new(bytes.Buffer)
+		if err := r.writePackage(&originalZip.Reader, buf, xmlContent); err != nil {
+			return err
+		}
+		flat, err := FlattenPackage(buf.Bytes())
+		if err != nil {
+			return err
+		}
+		return os.WriteFile(dstZipPath, flat, 0o644)
+	}
+
 	// Create a backup or a new output file
 	newFile, err := os.Create(dstZipPath)
 	if err != nil {
@@ -258,10 +557,31 @@ func (r *Replacer) WriteContent(srcZipPath, dstZipPath string, xmlContent string
 	}
 	defer newFile.Close()
 
-	zipWriter := zip.NewWriter(newFile)
+	return r.writePackage(&originalZip.Reader, newFile, xmlContent)
+}
+
+// writePackage writes the files of originalZip with the new content.xml and
+// the files registered through AddFile to w.
+func (r *Replacer) writePackage(originalZip *zip.Reader, w io.Writer, xmlContent string) error {
+	zipWriter := zip.NewWriter(w)
 	defer zipWriter.Close()
 
+	added := make(map[string]bool, len(r.files))
+	for _, f := range r.files {
+		added[f.Name] = true
+	}
+
 	for _, file := range originalZip.File {
+		if added[file.Name] {
+			// replaced by a file registered through AddFile
+			continue
+		}
+		if file.Name == "META-INF/manifest.xml" && len(r.files) > 0 {
+			if err := r.writeManifest(zipWriter, file); err != nil {
+				return err
+			}
+			continue
+		}
 		if file.Name == "content.xml" {
 			// Create a fresh header for the new content.xml;
 			// we cannot reuse the original header because the
@@ -285,16 +605,67 @@ func (r *Replacer) WriteContent(srcZipPath, dstZipPath string, xmlContent string
 			}
 		}
 	}
-	return nil
+
+	for _, f := range r.files {
+		writer, err := zipWriter.CreateHeader(&zip.FileHeader{
+			Name:   f.Name,
+			Method: zip.Deflate,
+		})
+		if err != nil {
+			return err
+		}
+		if _, err := writer.Write(f.Data); err != nil {
+			return err
+		}
+	}
+	return zipWriter.Close()
 }
 
-func ConvertODTToPDF(odtPath, pdfPath string) error {
-	// executes `libreoffice --headless --convert-to pdf <odtPath> --outdir <dir>`
-	outDir := filepath.Dir(pdfPath)
-	cmd := exec.Command("libreoffice", "--headless", "--convert-to", "pdf", odtPath, "--outdir", outDir)
-	output, err := cmd.CombinedOutput()
+// writeManifest copies META-INF/manifest.xml and adds an entry for every
+// file registered through AddFile.
+func (r *Replacer) writeManifest(zipWriter *zip.Writer, file *zip.File) error {
+	rc, err := file.Open()
 	if err != nil {
-		return fmt.Errorf("libreoffice conversion failed: %w\noutput: %s", err, string(output))
+		return err
 	}
-	return nil
+	defer rc.Close()
+
+	manifest := etree.NewDocument()
+	if _, err := manifest.ReadFrom(rc); err != nil {
+		return fmt.Errorf("failed to parse manifest: %w", err)
+	}
+	root := manifest.Root()
+	if root == nil {
+		return fmt.Errorf("manifest is empty")
+	}
+
+	for _, f := range r.files {
+		exists := false
+		for _, entry := range root.SelectElements("manifest:file-entry") {
+			if entry.SelectAttrValue("manifest:full-path", "") == f.Name {
+				entry.CreateAttr("manifest:media-type", f.MediaType)
+				exists = true
+			}
+		}
+		if !exists {
+			entry := root.CreateElement("manifest:file-entry")
+			entry.CreateAttr("manifest:full-path", f.Name)
+			entry.CreateAttr("manifest:media-type", f.MediaType)
+		}
+	}
+
+	writer, err := zipWriter.CreateHeader(&zip.FileHeader{
+		Name:   file.Name,
+		Method: zip.Deflate,
+	})
+	if err != nil {
+		return err
+	}
+	_, err = manifest.WriteTo(writer)
+	return err
+}
+
+// ConvertODTToPDF converts a document to PDF with DefaultConverter.
+func ConvertODTToPDF(odtPath, pdfPath string) error {
+	return DefaultConverter.Convert(context.Background(), odtPath, pdfPath, FormatPDF)
 }
@@ -0,0 +1,29 @@
+package godtemplate
+
+import (
+	"testing"
+
+	"github.com/beevik/etree"
+)
+
+func TestReplaceValuesEscapesValues(t *testing.T) {
+	template := `<office:text><text:p>Pay at $PAYMENTURL</text:p><text:p>$NAME</text:p></office:text>`
+	mapping := [][2]string{
+		{"paymenturl", "https://pay.example.com/?invoice=1&customer=2"},
+		{"name", `A & B "<GmbH>"`},
+	}
+
+	result := (&Replacer{}).ReplaceValues(template, mapping)
+
+	doc := etree.NewDocument()
+	if err := doc.ReadFromString(result); err != nil {
+		t.Fatalf("result is not well-formed XML: %v\n%s", err, result)
+	}
+	paragraphs := doc.FindElements("//text:p")
+	if got, want := paragraphs[0].Text(), "Pay at https://pay.example.com/?invoice=1&customer=2"; got != want {
+		t.Errorf("text = %q, want %q", got, want)
+	}
+	if got, want := paragraphs[1].Text(), `A & B "<GmbH>"`; got != want {
+		t.Errorf("text = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,258 @@
+package godtemplate
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"path"
+	"strings"
+
+	"github.com/beevik/etree"
+)
+
+// Merge appends the documents inputs[1:] to the document inputs[0] and writes
+// the result to output. Every appended document starts on a new page. Its
+// automatic styles are copied with the prefix "doc<n>_"; the common styles,
+// page layouts and settings of the first document apply to all of them.
+// Pictures with the same content are stored only once, and names of tables,
+// frames and sections are made unique. Frames anchored to a page are anchored
+// to the first paragraph of their document instead, so they stay on its
+// first page.
+func Merge(output string, inputs ...string) error {
+	if len(inputs) == 0 {
+		return fmt.Errorf("no documents to merge")
+	}
+
+	base, err := openPackage(inputs[0])
+	if err != nil {
+		return err
+	}
+	defer base.Close()
+
+	doc, err := readPackageXML(&base.Reader, "content.xml")
+	if err != nil {
+		return err
+	}
+	text := doc.Root().FindElement("office:body/office:text")
+	if text == nil {
+		return fmt.Errorf("%s has no text body", inputs[0])
+	}
+
+	m := &merger{
+		r:        &Replacer{},
+		doc:      doc,
+		text:     text,
+		pictures: map[string]string{},
+		files:    map[string]bool{},
+		names:    objectNames(doc.Root()),
+	}
+	for _, f := range base.File {
+		m.files[f.Name] = true
+		if strings.HasPrefix(f.Name, "Pictures/") {
+			data, err := readPackageFile(&base.Reader, f.Name)
+			if err != nil {
+				return err
+			}
+			m.pictures[pictureHash(data)] = f.Name
+		}
+	}
+
+	for i, input := range inputs[1:] {
+		if err := m.append(input, i+2); err != nil {
+			return fmt.Errorf("failed to append %s: %w", input, err)
+		}
+	}
+
+	xmlContent, err := doc.WriteToString()
+	if err != nil {
+		return fmt.Errorf("failed to write document to string: %w", err)
+	}
+	return m.r.WriteContent(inputs[0], output, xmlContent)
+}
+
+// merger appends documents to the content of the first one.
+type merger struct {
+	r    *Replacer
+	doc  *etree.Document
+	text *etree.Element
+	// pictures maps the hash of the pictures in the package to their name
+	pictures map[string]string
+	// files are the names of all files in the package
+	files map[string]bool
+	// names are the names of tables, frames and sections in the document
+	names map[string]bool
+}
+
+func (m *merger) append(input string, number int) error {
+	zr, err := openPackage(input)
+	if err != nil {
+		return err
+	}
+	defer zr.Close()
+
+	content, err := readPackageXML(&zr.Reader, "content.xml")
+	if err != nil {
+		return err
+	}
+	text := content.Root().FindElement("office:body/office:text")
+	if text == nil {
+		return fmt.Errorf("document has no text body")
+	}
+
+	body := []*etree.Element{}
+	frames := []*etree.Element{}
+	for _, e := range text.ChildElements() {
+		switch {
+		case bodyDeclarations[e.FullTag()]:
+		case e.SelectAttrValue("text:anchor-type", "") == "page":
+			frames = append(frames, e)
+		default:
+			body = append(body, e)
+		}
+	}
+
+	prefix := fmt.Sprintf("doc%d_", number)
+	importAutomaticStyles(m.doc.Root(), content.Root(), prefix, append(body, frames...))
+
+	for _, e := range append(body, frames...) {
+		if err := importPictures(&zr.Reader, e, m.addPicture(prefix)); err != nil {
+			return err
+		}
+		renameObjects(e, m.names, number)
+	}
+
+	// the page break needs a leading paragraph or table, page anchored frames
+	// a leading paragraph
+	first := ""
+	if len(body) > 0 {
+		first = body[0].FullTag()
+	}
+	if first != "text:p" && first != "text:h" && (first != "table:table" || len(frames) > 0) {
+		body = append([]*etree.Element{etree.NewElement("text:p")}, body...)
+	}
+	for i := len(frames) - 1; i >= 0; i-- {
+		frame := frames[i]
+		frame.CreateAttr("text:anchor-type", "paragraph")
+		frame.RemoveAttr("text:anchor-page-number")
+		body[0].InsertChildAt(0, frame)
+	}
+	if err := pageBreakBefore(m.doc.Root(), body[0], prefix); err != nil {
+		return err
+	}
+
+	for _, e := range body {
+		m.text.AddChild(e)
+	}
+	return nil
+}
+
+// addPicture returns a function adding pictures to the package, reusing
+// pictures with the same content.
+func (m *merger) addPicture(prefix string) func(href string, data []byte, mediaType string) string {
+	return func(href string, data []byte, mediaType string) string {
+		hash := pictureHash(data)
+		if name, ok := m.pictures[hash]; ok {
+			return name
+		}
+		name := href
+		if m.files[name] {
+			name = "Pictures/" + prefix + path.Base(href)
+		}
+		m.files[name] = true
+		m.pictures[hash] = name
+		return m.r.AddFile(name, data, mediaType)
+	}
+}
+
+// objectAttributes are the attributes naming objects that must be unique in
+// a document.
+var objectAttributes = []string{"table:name", "draw:name"}
+
+// objectNames returns the names of the tables, frames and sections of a
+// document.
+func objectNames(root *etree.Element) map[string]bool {
+	names := map[string]bool{}
+	for _, e := range root.FindElements(".//*") {
+		for _, attribute := range objectAttributes {
+			if name := e.SelectAttrValue(attribute, ""); name != "" {
+				names[name] = true
+			}
+		}
+		if e.FullTag() == "text:section" {
+			names[e.SelectAttrValue("text:name", "")] = true
+		}
+	}
+	return names
+}
+
+// renameObjects makes the names of tables, frames and sections of e unique
+// among names by appending number, e.g. the number of the document, and adds
+// them to names.
+func renameObjects(e *etree.Element, names map[string]bool, number int) {
+	for _, element := range append([]*etree.Element{e}, e.FindElements(".//*")...) {
+		attributes := objectAttributes
+		if element.FullTag() == "text:section" {
+			attributes = append(attributes, "text:name")
+		}
+		for _, attribute := range attributes {
+			name := element.SelectAttrValue(attribute, "")
+			if name == "" {
+				continue
+			}
+			if names[name] {
+				name = uniqueStyleName(fmt.Sprintf("%s_%d", name, number), names)
+				element.CreateAttr(attribute, name)
+			}
+			names[name] = true
+		}
+	}
+}
+
+// pageBreakBefore lets a paragraph or table start on a new page, using a copy
+// of its automatic style or a new style derived from its common style.
+func pageBreakBefore(root, e *etree.Element, prefix string) error {
+	var family, attribute, properties string
+	switch e.FullTag() {
+	case "text:p", "text:h":
+		family, attribute, properties = "paragraph", "text:style-name", "style:paragraph-properties"
+	case "table:table":
+		family, attribute, properties = "table", "table:style-name", "style:table-properties"
+	default:
+		return fmt.Errorf("cannot start %s on a new page", e.FullTag())
+	}
+
+	automatic := automaticStyles(root)
+	name := e.SelectAttrValue(attribute, "")
+
+	var style *etree.Element
+	for _, s := range automatic.SelectElements("style:style") {
+		if s.SelectAttrValue("style:name", "") == name && s.SelectAttrValue("style:family", "") == family {
+			style = s.Copy()
+			break
+		}
+	}
+	if style == nil {
+		style = etree.NewElement("style:style")
+		style.CreateAttr("style:family", family)
+		if name != "" {
+			style.CreateAttr("style:parent-style-name", name)
+		}
+	}
+
+	breakName := uniqueStyleName(prefix+"PageBreak", automaticStyleNames(root))
+	style.CreateAttr("style:name", breakName)
+	props := style.SelectElement(properties)
+	if props == nil {
+		props = style.CreateElement(properties)
+	}
+	props.CreateAttr("fo:break-before", "page")
+
+	automatic.AddChild(style)
+	e.CreateAttr(attribute, breakName)
+	return nil
+}
+
+func pictureHash(data []byte) string {
+	sum := sha1.Sum(data)
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,202 @@
+package godtemplate
+
+import (
+	"crypto/sha1"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/beevik/etree"
+)
+
+// SlideData is the content of a template slide of a presentation (.odp) that
+// is repeated for every entry, e.g. one slide per product of a proposal.
+//
+// The template slide is found by its name (Rename Slide in Impress), which is
+// also the name of its placeholders: $products.title and
+// $products.price:number in text boxes for entries that are maps, or
+// $products for entries that are strings. Frames of pictures named like a
+// placeholder (Name in the context menu of the picture), e.g.
+// $products.photo, show the picture of the entry. The slide is copied for
+// every entry and then removed.
+type SlideData struct {
+	Name  string
+	Items []any
+	// Format renders a value for a placeholder like $products.price:number.
+	// If nil, FormatValue is used.
+	Format func(value any, format string) (string, error) `json:"-"`
+}
+
+// slideReferenceAttributes reference shapes of the same slide by their id.
+var slideReferenceAttributes = []string{"smil:targetElement", "draw:start-shape", "draw:end-shape"}
+
+// FillSlides fills all given template slides of a presentation.
+func (r *Replacer) FillSlides(doc *etree.Document, slides []SlideData) error {
+	for _, slide := range slides {
+		if err := r.FillSlide(doc, slide); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// FillSlide copies a template slide for every entry and fills the copies.
+// The copies are named after the template slide with their number, e.g.
+// "products 1", "products 2"; ids of their shapes get the number as suffix, so
+// animations and connectors keep referencing the shapes of their own slide.
+func (r *Replacer) FillSlide(doc *etree.Document, data SlideData) error {
+	format := data.Format
+	if format == nil {
+		format = FormatValue
+	}
+
+	prototype := findSlide(doc, data.Name)
+	if prototype == nil {
+		return fmt.Errorf("slide %s not found", data.Name)
+	}
+
+	pattern := listPattern(data.Name)
+	parent := prototype.Parent()
+	for i, entry := range data.Items {
+		slide := prototype.Copy()
+		suffix := fmt.Sprintf(" %d", i+1)
+		slide.CreateAttr("draw:name", data.Name+suffix)
+		renameSlideIDs(slide, strings.ReplaceAll(suffix, " ", "_"))
+
+		err := ReplaceText(slide, pattern, func(match []string) (string, error) {
+			value, err := listValue(entry, strings.ToLower(match[1]))
+			if err != nil {
+				return "", err
+			}
+			return format(value, strings.ToLower(match[2]))
+		})
+		if err != nil {
+			return fmt.Errorf("failed to fill slide %s: %w", data.Name, err)
+		}
+
+		for _, frame := range slide.FindElements(".//draw:frame[@draw:name]") {
+			match := pattern.FindStringSubmatch(frame.SelectAttrValue("draw:name", ""))
+			if match == nil || match[0] != frame.SelectAttrValue("draw:name", "") {
+				continue
+			}
+			value, err := listValue(entry, strings.ToLower(match[1]))
+			if err != nil {
+				return fmt.Errorf("failed to fill slide %s: %w", data.Name, err)
+			}
+			picture, err := pictureData(value)
+			if err != nil {
+				return fmt.Errorf("failed to fill slide %s: %w", data.Name, err)
+			}
+			if err := r.replaceFramePicture(frame, picture); err != nil {
+				return fmt.Errorf("failed to fill slide %s: %w", data.Name, err)
+			}
+			frame.RemoveAttr("draw:name")
+		}
+
+		parent.InsertChildAt(prototype.Index(), slide)
+	}
+	parent.RemoveChild(prototype)
+	return nil
+}
+
+// ReplaceImage replaces the picture of all frames named frameName (Name in
+// the context menu of the picture) by data, e.g. the logo of a customer. The
+// picture is stretched to the size of the frame. PNG, JPEG, GIF, BMP, WebP
+// and SVG pictures are supported.
+func (r *Replacer) ReplaceImage(doc *etree.Document, frameName string, data []byte) error {
+	found := false
+	for _, frame := range doc.FindElements("//draw:frame[@draw:name]") {
+		if frame.SelectAttrValue("draw:name", "") != frameName {
+			continue
+		}
+		if err := r.replaceFramePicture(frame, data); err != nil {
+			return fmt.Errorf("failed to replace image %s: %w", frameName, err)
+		}
+		found = true
+	}
+	if !found {
+		return fmt.Errorf("image %s not found", frameName)
+	}
+	return nil
+}
+
+// replaceFramePicture adds data to the package and references it from the
+// picture of frame. Fallback pictures of the frame (e.g. a PNG rendering of
+// an SVG) are removed.
+func (r *Replacer) replaceFramePicture(frame *etree.Element, data []byte) error {
+	images := frame.SelectElements("draw:image")
+	if len(images) == 0 {
+		return fmt.Errorf("frame has no picture")
+	}
+
+	mediaType := detectPictureType(data)
+	extension, ok := pictureExtensions[mediaType]
+	if !ok {
+		return fmt.Errorf("unsupported picture type: %s", mediaType)
+	}
+
+	image := images[0]
+	for _, fallback := range images[1:] {
+		frame.RemoveChild(fallback)
+	}
+	if binary := image.SelectElement("office:binary-data"); binary != nil {
+		image.RemoveChild(binary)
+	}
+
+	name := fmt.Sprintf("Pictures/%x%s", sha1.Sum(data), extension)
+	image.CreateAttr("xlink:href", r.AddFile(name, data, mediaType))
+	image.CreateAttr("xlink:type", "simple")
+	image.CreateAttr("xlink:show", "embed")
+	image.CreateAttr("xlink:actuate", "onLoad")
+	image.CreateAttr("draw:mime-type", mediaType)
+	image.RemoveAttr("loext:mime-type")
+	return nil
+}
+
+// pictureData returns the picture of a slide entry, given as data or as the
+// path of a file.
+func pictureData(value any) ([]byte, error) {
+	switch v := value.(type) {
+	case []byte:
+		return v, nil
+	case string:
+		data, err := os.ReadFile(v)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read picture: %w", err)
+		}
+		return data, nil
+	default:
+		return nil, fmt.Errorf("unsupported picture value: %v", value)
+	}
+}
+
+// findSlide returns the slide of a presentation with the given name.
+func findSlide(doc *etree.Document, name string) *etree.Element {
+	for _, slide := range doc.FindElements("//office:presentation/draw:page") {
+		if slide.SelectAttrValue("draw:name", "") == name {
+			return slide
+		}
+	}
+	return nil
+}
+
+// renameSlideIDs appends suffix to the ids of the shapes of a copied slide
+// and to the references to them, which must be unique in the document.
+func renameSlideIDs(slide *etree.Element, suffix string) {
+	renamed := map[string]string{}
+	for _, e := range slide.FindElements(".//*") {
+		for _, attr := range []string{"xml:id", "draw:id"} {
+			if id := e.SelectAttrValue(attr, ""); id != "" {
+				renamed[id] = id + suffix
+				e.CreateAttr(attr, id+suffix)
+			}
+		}
+	}
+	for _, e := range slide.FindElements(".//*") {
+		for _, attr := range slideReferenceAttributes {
+			if target, ok := renamed[e.SelectAttrValue(attr, "")]; ok {
+				e.CreateAttr(attr, target)
+			}
+		}
+	}
+}
@@ -0,0 +1,431 @@
+package godtemplate
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/beevik/etree"
+)
+
+// Names of the automatic text styles used for rich text.
+const (
+	RichTextBold       = "RichTextBold"
+	RichTextItalic     = "RichTextItalic"
+	RichTextBoldItalic = "RichTextBoldItalic"
+	// RichTextList is the list style of bullet points.
+	RichTextList = "RichTextList"
+)
+
+// richTextPattern matches placeholders rendered as rich text, e.g.
+// $VATHINT:markdown
+var richTextPattern = regexp.MustCompile(`\$([A-Za-z0-9_]+):(?i:markdown)\b`)
+
+// richLine is a line of rich text, either a paragraph line or a bullet
+// point.
+type richLine struct {
+	Runs   []richRun
+	Bullet bool
+}
+
+// richRun is a piece of rich text with the same formatting.
+type richRun struct {
+	Text   string
+	Bold   bool
+	Italic bool
+	Link   string
+}
+
+// parseMarkdown parses the Markdown subset supported for rich text values:
+// **bold**, *italic*, [links](https://example.com), line breaks and lines
+// starting with "- " or "* " as bullet points. A backslash escapes the next
+// character; markers without closing counterpart are kept as text.
+func parseMarkdown(text string) []richLine {
+	lines := []richLine{}
+	for _, line := range strings.Split(text, "\n") {
+		bullet := strings.HasPrefix(line, "- ") || strings.HasPrefix(line, "* ")
+		if bullet {
+			line = line[2:]
+		}
+		lines = append(lines, richLine{Runs: parseInline(line, false, false, ""), Bullet: bullet})
+	}
+	return lines
+}
+
+func parseInline(text string, bold, italic bool, link string) []richRun {
+	runs := []richRun{}
+	var sb strings.Builder
+	flush := func() {
+		if sb.Len() > 0 {
+			runs = append(runs, richRun{Text: sb.String(), Bold: bold, Italic: italic, Link: link})
+			sb.Reset()
+		}
+	}
+
+	for i := 0; i < len(text); i++ {
+		c := text[i]
+		switch {
+		case c == '\\' && i+1 < len(text):
+			i++
+			sb.WriteByte(text[i])
+		case strings.HasPrefix(text[i:], "**"):
+			end := strings.Index(text[i+2:], "**")
+			if end <= 0 {
+				sb.WriteString("**")
+				i++
+				continue
+			}
+			flush()
+			runs = append(runs, parseInline(text[i+2:i+2+end], true, italic, link)...)
+			i += 3 + end
+		case c == '*':
+			end := closingAsterisk(text[i+1:])
+			if end <= 0 {
+				sb.WriteByte(c)
+				continue
+			}
+			flush()
+			runs = append(runs, parseInline(text[i+1:i+1+end], bold, true, link)...)
+			i += 1 + end
+		case c == '[' && link == "":
+			label, url, length, ok := parseLink(text[i:])
+			if !ok {
+				sb.WriteByte(c)
+				continue
+			}
+			flush()
+			runs = append(runs, parseInline(label, bold, italic, url)...)
+			i += length - 1
+		default:
+			sb.WriteByte(c)
+		}
+	}
+	flush()
+	return runs
+}
+
+// closingAsterisk returns the index of the single asterisk closing an italic
+// span, skipping bold markers.
+func closingAsterisk(text string) int {
+	for i := 0; i < len(text); i++ {
+		switch {
+		case text[i] == '\\':
+			i++
+		case strings.HasPrefix(text[i:], "**"):
+			i++
+		case text[i] == '*':
+			return i
+		}
+	}
+	return -1
+}
+
+// parseLink parses [label](url) at the start of text.
+func parseLink(text string) (label, url string, length int, ok bool) {
+	closing := strings.Index(text, "](")
+	if closing < 0 {
+		return "", "", 0, false
+	}
+	end := strings.IndexByte(text[closing+2:], ')')
+	if end < 0 {
+		return "", "", 0, false
+	}
+	return text[1:closing], text[closing+2 : closing+2+end], closing + 3 + end, true
+}
+
+// RichTextTokens converts Markdown into text nodes, spans with the rich text
+// styles, text:a hyperlinks, text:line-break elements and text:list elements
+// for bullet points. The lists are left inside the tokens; FinishRichText
+// moves them out of the paragraph they are inserted into and adds the styles.
+func RichTextTokens(markdown string) []etree.Token {
+	tokens := []etree.Token{}
+	var list *etree.Element
+	for i, line := range parseMarkdown(markdown) {
+		if line.Bullet {
+			if list == nil {
+				list = etree.NewElement("text:list")
+				list.CreateAttr("text:style-name", RichTextList)
+				tokens = append(tokens, list)
+			}
+			p := list.CreateElement("text:list-item").CreateElement("text:p")
+			for _, token := range richRunTokens(line.Runs) {
+				p.AddChild(token)
+			}
+			continue
+		}
+
+		if i > 0 && list == nil {
+			tokens = append(tokens, etree.NewElement("text:line-break"))
+		}
+		list = nil
+		tokens = append(tokens, richRunTokens(line.Runs)...)
+	}
+	return tokens
+}
+
+func richRunTokens(runs []richRun) []etree.Token {
+	tokens := []etree.Token{}
+	for _, run := range runs {
+		var token etree.Token = etree.NewText(run.Text)
+		if style := richTextStyle(run.Bold, run.Italic); style != "" {
+			span := etree.NewElement("text:span")
+			span.CreateAttr("text:style-name", style)
+			span.SetText(run.Text)
+			token = span
+		}
+		if run.Link != "" {
+			a := etree.NewElement("text:a")
+			a.CreateAttr("xlink:type", "simple")
+			a.CreateAttr("xlink:href", run.Link)
+			a.AddChild(token)
+			token = a
+		}
+		tokens = append(tokens, token)
+	}
+	return tokens
+}
+
+func richTextStyle(bold, italic bool) string {
+	switch {
+	case bold && italic:
+		return RichTextBoldItalic
+	case bold:
+		return RichTextBold
+	case italic:
+		return RichTextItalic
+	default:
+		return ""
+	}
+}
+
+// FinishRichText completes the rich text inserted into the document
+// containing e: bullet lists are moved out of the paragraphs they were
+// inserted into, hyperlinks inside hyperlinks are unwrapped (neither may be
+// nested in ODF) and the automatic styles used by rich text are added unless
+// they already exist.
+func FinishRichText(e *etree.Element) error {
+	root := e
+	for root.Parent() != nil && root.Parent().Tag != "" {
+		root = root.Parent()
+	}
+	if root.FullTag() != "office:document-content" && root.FullTag() != "office:document" {
+		return fmt.Errorf("element is not part of a document")
+	}
+
+	liftRichText(root)
+	styles := automaticStyles(root)
+
+	definitions := []struct {
+		name         string
+		bold, italic bool
+	}{
+		{RichTextBold, true, false},
+		{RichTextItalic, false, true},
+		{RichTextBoldItalic, true, true},
+	}
+	for _, definition := range definitions {
+		if styles.FindElement(fmt.Sprintf("style:style[@style:name='%s']", definition.name)) != nil {
+			continue
+		}
+		style := styles.CreateElement("style:style")
+		style.CreateAttr("style:name", definition.name)
+		style.CreateAttr("style:family", "text")
+		properties := style.CreateElement("style:text-properties")
+		if definition.bold {
+			properties.CreateAttr("fo:font-weight", "bold")
+			properties.CreateAttr("style:font-weight-asian", "bold")
+			properties.CreateAttr("style:font-weight-complex", "bold")
+		}
+		if definition.italic {
+			properties.CreateAttr("fo:font-style", "italic")
+			properties.CreateAttr("style:font-style-asian", "italic")
+			properties.CreateAttr("style:font-style-complex", "italic")
+		}
+	}
+	if styles.FindElement(fmt.Sprintf("text:list-style[@style:name='%s']", RichTextList)) == nil {
+		styles.AddChild(richTextListStyle())
+	}
+	return nil
+}
+
+// richTextListStyle returns the list style of bullet points: a bullet with a
+// hanging indent, so wrapped lines align with the text of the first line.
+func richTextListStyle() *etree.Element {
+	style := etree.NewElement("text:list-style")
+	style.CreateAttr("style:name", RichTextList)
+	level := style.CreateElement("text:list-level-style-bullet")
+	level.CreateAttr("text:level", "1")
+	level.CreateAttr("text:bullet-char", "•")
+	properties := level.CreateElement("style:list-level-properties")
+	properties.CreateAttr("text:list-level-position-and-space-mode", "label-alignment")
+	alignment := properties.CreateElement("style:list-level-label-alignment")
+	alignment.CreateAttr("text:label-followed-by", "listtab")
+	alignment.CreateAttr("text:list-tab-stop-position", "0.635cm")
+	alignment.CreateAttr("fo:text-indent", "-0.635cm")
+	alignment.CreateAttr("fo:margin-left", "0.635cm")
+	return style
+}
+
+// liftRichText moves lists out of the paragraphs of e and unwraps nested
+// hyperlinks.
+func liftRichText(e *etree.Element) {
+	for _, a := range e.FindElements(".//text:a//text:a") {
+		unwrapElement(a)
+	}
+	for {
+		list := inlineList(e)
+		if list == nil {
+			return
+		}
+		liftList(list)
+	}
+}
+
+// inlineList returns the first list of e inside a paragraph or heading.
+func inlineList(e *etree.Element) *etree.Element {
+	for _, list := range e.FindElements(".//text:list") {
+		if enclosingParagraph(list) != nil {
+			return list
+		}
+	}
+	return nil
+}
+
+// enclosingParagraph returns the paragraph or heading containing e, stopping
+// at list items, cells and frames, which contain paragraphs themselves.
+func enclosingParagraph(e *etree.Element) *etree.Element {
+	for parent := e.Parent(); parent != nil; parent = parent.Parent() {
+		switch parent.FullTag() {
+		case "text:p", "text:h":
+			return parent
+		case "text:list-item", "table:table-cell", "draw:text-box", "office:text":
+			return nil
+		}
+	}
+	return nil
+}
+
+// liftList splits the paragraph containing list into the content before the
+// list, the list and the content after it. The paragraphs of the list items
+// take the attributes of the paragraph and are wrapped into copies of the
+// spans between paragraph and list, so they keep their formatting.
+func liftList(list *etree.Element) {
+	p := enclosingParagraph(list)
+	spans := []*etree.Element{}
+	for parent := list.Parent(); parent != p; parent = parent.Parent() {
+		spans = append(spans, parent)
+	}
+
+	before, after := splitElement(p, list)
+	for _, item := range list.SelectElements("text:list-item") {
+		for _, paragraph := range item.SelectElements("text:p") {
+			content := removeChildren(paragraph)
+			target := paragraph
+			for i := len(spans) - 1; i >= 0; i-- {
+				span := shallowCopy(spans[i])
+				target.AddChild(span)
+				target = span
+			}
+			for _, token := range content {
+				target.AddChild(token)
+			}
+			paragraph.Attr = append([]etree.Attr(nil), p.Attr...)
+			removeXMLIDs(paragraph)
+		}
+	}
+
+	parent := p.Parent()
+	index := p.Index()
+	parent.RemoveChildAt(index)
+	for _, e := range []*etree.Element{before, list, after} {
+		if e == list || !isEmptyParagraph(e) {
+			parent.InsertChildAt(index, e)
+			index++
+		}
+	}
+}
+
+// splitElement splits e at its descendant at into copies of e holding the
+// content before and after it. at itself is removed.
+func splitElement(e, at *etree.Element) (before, after *etree.Element) {
+	before, after = shallowCopy(e), shallowCopy(e)
+	target := at
+	for target.Parent() != e {
+		target = target.Parent()
+	}
+	index := target.Index()
+	for i, token := range removeChildren(e) {
+		switch {
+		case i < index:
+			before.AddChild(token)
+		case i > index:
+			after.AddChild(token)
+		case target != at:
+			b, a := splitElement(target, at)
+			before.AddChild(b)
+			after.AddChild(a)
+		}
+	}
+	removeXMLIDs(after)
+	return before, after
+}
+
+// shallowCopy returns a copy of e without its content.
+func shallowCopy(e *etree.Element) *etree.Element {
+	c := etree.NewElement(e.Tag)
+	c.Space = e.Space
+	c.Attr = append([]etree.Attr(nil), e.Attr...)
+	return c
+}
+
+// isEmptyParagraph reports whether a part of a split paragraph has neither
+// text nor other content than spans.
+func isEmptyParagraph(p *etree.Element) bool {
+	if strings.TrimSpace(ElementText(p)) != "" {
+		return false
+	}
+	for _, e := range p.FindElements(".//*") {
+		if e.FullTag() != "text:span" {
+			return false
+		}
+	}
+	return true
+}
+
+// removeChildren removes the content of e and returns it.
+func removeChildren(e *etree.Element) []etree.Token {
+	tokens := append([]etree.Token(nil), e.Child...)
+	for len(e.Child) > 0 {
+		e.RemoveChildAt(len(e.Child) - 1)
+	}
+	return tokens
+}
+
+// unwrapElement replaces e by its content.
+func unwrapElement(e *etree.Element) {
+	parent := e.Parent()
+	index := e.Index()
+	parent.RemoveChildAt(index)
+	for _, token := range removeChildren(e) {
+		parent.InsertChildAt(index, token)
+		index++
+	}
+}
+
+// ReplaceRichText renders placeholders like $VATHINT:markdown with the value
+// of the key in mapping as rich text. Placeholders of unknown keys are kept.
+func (r *Replacer) ReplaceRichText(doc *etree.Document, mapping [][2]string) error {
+	found := false
+	err := ReplaceTokens(doc.Root(), richTextPattern, func(match []string) ([]etree.Token, error) {
+		value, ok := lookupMapping(mapping, match[1])
+		if !ok {
+			return []etree.Token{etree.NewText(match[0])}, nil
+		}
+		found = true
+		return RichTextTokens(value), nil
+	})
+	if err != nil || !found {
+		return err
+	}
+	return FinishRichText(doc.Root())
+}
@@ -0,0 +1,291 @@
+package godtemplate
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/beevik/etree"
+)
+
+// CellValue is the content of a table cell: the displayed text and, for cells
+// with a numeric, date or boolean value type, the raw value stored in the
+// value attribute of the cell.
+type CellValue struct {
+	Text  string
+	Value string
+	// Type is the office:value-type of the cell ("float", "currency",
+	// "percentage", "date", "time" or "boolean"). If empty, new cells are
+	// string cells and cells of prototype rows keep their type.
+	Type string
+	// Currency is the ISO 4217 code stored as office:currency of currency
+	// cells.
+	Currency string
+	// Rich marks Text as Markdown rendered with bold and italic spans,
+	// hyperlinks and line breaks (see RichTextTokens).
+	Rich bool
+}
+
+// tokens returns the text of the value as tokens for a paragraph.
+func (v CellValue) tokens() []etree.Token {
+	if v.Rich {
+		return RichTextTokens(v.Text)
+	}
+	return TextTokens(v.Text)
+}
+
+// FloatCell returns a numeric cell displaying text.
+func FloatCell(value float64, text string) CellValue {
+	return CellValue{Text: text, Value: strconv.FormatFloat(value, 'f', -1, 64), Type: "float"}
+}
+
+// CurrencyCell returns a monetary cell displaying text.
+func CurrencyCell(value float64, currency, text string) CellValue {
+	return CellValue{Text: text, Value: strconv.FormatFloat(value, 'f', -1, 64), Type: "currency", Currency: currency}
+}
+
+// PercentageCell returns a percentage cell displaying text. The value is a
+// fraction, i.e. 0.19 for 19 %.
+func PercentageCell(value float64, text string) CellValue {
+	return CellValue{Text: text, Value: strconv.FormatFloat(value, 'f', -1, 64), Type: "percentage"}
+}
+
+// DateCell returns a date cell displaying text.
+func DateCell(value time.Time, text string) CellValue {
+	return CellValue{Text: text, Value: value.Format("2006-01-02"), Type: "date"}
+}
+
+// BooleanCell returns a boolean cell displaying text.
+func BooleanCell(value bool, text string) CellValue {
+	return CellValue{Text: text, Value: strconv.FormatBool(value), Type: "boolean"}
+}
+
+// RowValues returns the value of a placeholder in a prototype row, e.g. for
+// $item.deliverydate:date the key "deliverydate" and the format "date".
+type RowValues func(key, format string) (CellValue, error)
+
+// prototypePattern matches placeholders like $item.total or $item.date:date
+func prototypePattern(prefix string) *regexp.Regexp {
+	return regexp.MustCompile(`\$` + regexp.QuoteMeta(prefix) + `\.([A-Za-z0-9_]+)(?::([A-Za-z]+))?`)
+}
+
+// valueAttributes maps the office:value-type of a cell to the attribute
+// holding its raw value.
+var valueAttributes = map[string]string{
+	"float":      "office:value",
+	"percentage": "office:value",
+	"currency":   "office:value",
+	"date":       "office:date-value",
+	"time":       "office:time-value",
+	"boolean":    "office:boolean-value",
+}
+
+// FindPrototypeRows returns the rows of a table that contain placeholders
+// with the given prefix, e.g. $item.description for the prefix "item".
+func (r *Replacer) FindPrototypeRows(table *etree.Element, prefix string) []*etree.Element {
+	pattern := prototypePattern(prefix)
+	rows := []*etree.Element{}
+	if table.FullTag() == "w:tbl" {
+		for _, row := range table.SelectElements("w:tr") {
+			if pattern.MatchString(DocxText(row)) {
+				rows = append(rows, row)
+			}
+		}
+		return rows
+	}
+	for _, row := range tableRows(table) {
+		if pattern.MatchString(rowText(row)) {
+			rows = append(rows, row)
+		}
+	}
+	return rows
+}
+
+// tableRows returns the rows of a table, including header rows and rows of
+// row groups, but not the rows of tables nested in its cells.
+func tableRows(table *etree.Element) []*etree.Element {
+	rows := []*etree.Element{}
+	for _, child := range table.ChildElements() {
+		switch child.FullTag() {
+		case "table:table-row":
+			rows = append(rows, child)
+		case "table:table-header-rows", "table:table-rows", "table:table-row-group":
+			rows = append(rows, tableRows(child)...)
+		}
+	}
+	return rows
+}
+
+// rowText returns the text of the cells of a row without the text of nested
+// tables.
+func rowText(row *etree.Element) string {
+	var sb strings.Builder
+	for _, cell := range row.ChildElements() {
+		for _, child := range cell.ChildElements() {
+			if child.FullTag() != "table:table" {
+				sb.WriteString(ElementText(child))
+			}
+		}
+	}
+	return sb.String()
+}
+
+// InsertPrototypeRow inserts a deep copy of the prototype row in front of it
+// and replaces the placeholders with the given prefix by their values. All
+// cell, paragraph and span formatting of the prototype is kept. Cells with a
+// non-string value type that consist of a single placeholder get the raw
+// value of the placeholder; without a raw value they become string cells.
+// String cells consisting of a single placeholder take the type of the value.
+func (r *Replacer) InsertPrototypeRow(prototype *etree.Element, prefix string, values RowValues) (*etree.Element, error) {
+	return r.InsertPrototypeRowBefore(prototype, prototype, prefix, values)
+}
+
+// InsertPrototypeRowBefore works like InsertPrototypeRow, but inserts the copy
+// in front of the row before. With several prototype rows (group headers,
+// row styles) all copies are inserted before the first of them, so they keep
+// their order.
+func (r *Replacer) InsertPrototypeRowBefore(prototype, before *etree.Element, prefix string, values RowValues) (*etree.Element, error) {
+	parent := before.Parent()
+	if parent == nil {
+		return nil, fmt.Errorf("prototype row has no parent")
+	}
+	if prototype.FullTag() == "w:tr" {
+		return insertDocxPrototypeRow(prototype, before, prefix, values)
+	}
+
+	row := prototype.Copy()
+	pattern := prototypePattern(prefix)
+	rich := false
+
+	for _, cell := range row.FindElements(".//table:table-cell") {
+		text := strings.TrimSpace(ElementText(cell))
+		single := pattern.FindString(text) == text && text != ""
+
+		err := ReplaceTokens(cell, pattern, func(match []string) ([]etree.Token, error) {
+			value, err := values(strings.ToLower(match[1]), strings.ToLower(match[2]))
+			if err != nil {
+				return nil, err
+			}
+			if single {
+				setCellValue(cell, value)
+			}
+			rich = rich || value.Rich
+			return value.tokens(), nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	parent.InsertChildAt(before.Index(), row)
+	if rich {
+		if err := FinishRichText(before); err != nil {
+			return nil, err
+		}
+	}
+	return row, nil
+}
+
+// RemoveRow removes a row, e.g. a prototype row after all rows are inserted.
+func (r *Replacer) RemoveRow(row *etree.Element) {
+	if parent := row.Parent(); parent != nil {
+		parent.RemoveChild(row)
+	}
+}
+
+// fillCell replaces the content of a cell by the text of value, one paragraph
+// per line, or a single paragraph with line breaks for rich text. The paragraphs are copies of the first paragraph of the cell,
+// including a span the paragraph starts with, so character formatting of the
+// template cell is kept.
+func fillCell(cell *etree.Element, value CellValue) {
+	paragraph := etree.NewElement("text:p")
+	if first := cell.SelectElement("text:p"); first != nil {
+		paragraph = first.Copy()
+	}
+	for len(cell.Child) > 0 {
+		cell.RemoveChildAt(0)
+	}
+
+	if value.Rich {
+		p := paragraph.Copy()
+		target := leadingSpans(p)
+		for _, token := range value.tokens() {
+			target.AddChild(token)
+		}
+		cell.AddChild(p)
+	} else {
+		for _, line := range strings.Split(value.Text, "\n") {
+			p := paragraph.Copy()
+			leadingSpans(p).SetText(line)
+			cell.AddChild(p)
+		}
+	}
+	setCellValue(cell, value)
+}
+
+// leadingSpans strips all content of a paragraph except the spans it starts
+// with and returns the innermost of them (or the paragraph itself).
+func leadingSpans(p *etree.Element) *etree.Element {
+	target := p
+	for {
+		var span *etree.Element
+		for _, token := range target.Child {
+			if data, ok := token.(*etree.CharData); ok && strings.TrimSpace(data.Data) == "" {
+				continue
+			}
+			if e, ok := token.(*etree.Element); ok && e.FullTag() == "text:span" {
+				span = e
+			}
+			break
+		}
+
+		for i := len(target.Child) - 1; i >= 0; i-- {
+			if e, ok := target.Child[i].(*etree.Element); !ok || e != span {
+				target.RemoveChildAt(i)
+			}
+		}
+		if span == nil {
+			return target
+		}
+		target = span
+	}
+}
+
+// setCellValue stores the raw value of a typed cell. A typed prototype cell
+// keeps its type, a string cell takes the type of the value.
+// Cells without raw value are turned into string cells, so the displayed text
+// is not overridden by a stale value of the prototype.
+func setCellValue(cell *etree.Element, value CellValue) {
+	valueType := cell.SelectAttrValue("office:value-type", "")
+	if _, typed := valueAttributes[valueType]; !typed {
+		valueType = value.Type
+	}
+	attribute, typed := valueAttributes[valueType]
+	if !typed && cell.SelectAttr("office:value-type") == nil {
+		return
+	}
+	if !typed || value.Value == "" {
+		for _, attribute := range valueAttributes {
+			cell.RemoveAttr(attribute)
+		}
+		cell.RemoveAttr("office:currency")
+		setValueType(cell, "string")
+		return
+	}
+
+	setValueType(cell, valueType)
+	cell.CreateAttr(attribute, value.Value)
+	if valueType == "currency" && value.Currency != "" {
+		cell.CreateAttr("office:currency", value.Currency)
+	}
+}
+
+// setValueType sets the value type of a cell, including the LibreOffice
+// specific calcext:value-type if present.
+func setValueType(cell *etree.Element, valueType string) {
+	cell.CreateAttr("office:value-type", valueType)
+	if cell.SelectAttr("calcext:value-type") != nil {
+		cell.CreateAttr("calcext:value-type", valueType)
+	}
+}
@@ -0,0 +1,118 @@
+package godtemplate
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/beevik/etree"
+)
+
+// rowStylePattern matches markers like $rowstyle:even or $rowstyle:highlight
+// that name alternative prototype rows.
+var rowStylePattern = regexp.MustCompile(`\$(?i:rowstyle):([A-Za-z0-9_]+)`)
+
+// Row styles used for alternating rows if no other style is selected.
+const (
+	RowStyleOdd  = "odd"
+	RowStyleEven = "even"
+)
+
+// RowStyles are the prototype rows of a table by the name of their
+// $rowstyle:<name> marker. The row without marker has the empty name.
+type RowStyles map[string]*etree.Element
+
+// GetRowStyles returns the prototype rows by their style name and removes the
+// markers from them. More than one row without or with the same marker is an
+// error.
+func (r *Replacer) GetRowStyles(prototypes []*etree.Element) (RowStyles, error) {
+	styles := RowStyles{}
+	for _, row := range prototypes {
+		name := ""
+		if match := rowStylePattern.FindStringSubmatch(ElementText(row)); match != nil {
+			name = strings.ToLower(match[1])
+		}
+		if _, ok := styles[name]; ok {
+			if name == "" {
+				return nil, fmt.Errorf("more than one prototype row without $rowstyle marker")
+			}
+			return nil, fmt.Errorf("more than one prototype row with $rowstyle:%s", name)
+		}
+		removeMarker := ReplaceText
+		if row.FullTag() == "w:tr" {
+			removeMarker = replaceDocxText
+		}
+		err := removeMarker(row, rowStylePattern, func([]string) (string, error) {
+			return "", nil
+		})
+		if err != nil {
+			return nil, err
+		}
+		styles[name] = row
+	}
+	return styles, nil
+}
+
+// Select returns the prototype row for the row with the given zero based
+// index. A requested style must exist. Otherwise the odd and even rows are
+// used alternately if present, the first row being odd, and else the row
+// without marker.
+func (s RowStyles) Select(style string, index int) (*etree.Element, error) {
+	if style != "" {
+		row, ok := s[strings.ToLower(style)]
+		if !ok {
+			return nil, fmt.Errorf("row style %s not found", style)
+		}
+		return row, nil
+	}
+
+	alternate := RowStyleOdd
+	if index%2 == 1 {
+		alternate = RowStyleEven
+	}
+	if row, ok := s[alternate]; ok {
+		return row, nil
+	}
+	return s.Default()
+}
+
+// Default returns the row without marker, or the odd row if there is none.
+// It is used for rows that are not part of the alternation, e.g. sums.
+func (s RowStyles) Default() (*etree.Element, error) {
+	if row, ok := s[""]; ok {
+		return row, nil
+	}
+	if row, ok := s[RowStyleOdd]; ok {
+		return row, nil
+	}
+	return nil, fmt.Errorf("no prototype row without $rowstyle marker found")
+}
+
+// First returns the row of the styles that comes first in the table.
+func (s RowStyles) First() *etree.Element {
+	var first *etree.Element
+	for _, row := range s {
+		if first == nil || row.Index() < first.Index() {
+			first = row
+		}
+	}
+	return first
+}
+
+// Last returns the row of the styles that comes last in the table.
+func (s RowStyles) Last() *etree.Element {
+	var last *etree.Element
+	for _, row := range s {
+		if last == nil || row.Index() > last.Index() {
+			last = row
+		}
+	}
+	return last
+}
+
+// RemoveRowStyles removes all prototype rows of the styles.
+func (r *Replacer) RemoveRowStyles(styles RowStyles) {
+	for _, row := range styles {
+		r.RemoveRow(row)
+	}
+}
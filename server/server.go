@@ -10,6 +10,7 @@ import (
 	"path/filepath"
 	"time"
 
+	"github.com/mheers/godtemplate"
 	"github.com/mheers/godtemplate/invoicerenderer"
 	"github.com/sirupsen/logrus"
 )
@@ -25,6 +26,11 @@ type Server struct {
 	Port         string
 	TemplatePath string
 	Logger       *logrus.Logger
+	// Catalog provides the labels of $t:<key> placeholders in the locale of
+	// each invoice. It may be nil.
+	Catalog *godtemplate.Catalog
+	// Converter converts the rendered invoices to PDF.
+	Converter godtemplate.Converter
 }
 
 // NewServer creates a new server instance
@@ -36,6 +42,7 @@ func NewServer(port, templatePath string) *Server {
 		Port:         port,
 		TemplatePath: templatePath,
 		Logger:       logger,
+		Converter:    godtemplate.DefaultConverter,
 	}
 }
 
@@ -79,6 +86,8 @@ func (s *Server) renderInvoiceHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	req.Invoice.Catalog = s.Catalog
+
 	// Validate template path
 	if _, err := os.Stat(s.TemplatePath); os.IsNotExist(err) {
 		s.Logger.Errorf("Template file not found: %s", s.TemplatePath)
@@ -89,7 +98,11 @@ func (s *Server) renderInvoiceHandler(w http.ResponseWriter, r *http.Request) {
 	// Create temporary files for processing
 	tempDir := os.TempDir()
 	timestamp := time.Now().UnixNano()
-	tempODT := filepath.Join(tempDir, fmt.Sprintf("invoice_%d.odt", timestamp))
+	documentExtension := ".odt"
+	if godtemplate.IsDocxFile(s.TemplatePath) {
+		documentExtension = ".docx"
+	}
+	tempODT := filepath.Join(tempDir, fmt.Sprintf("invoice_%d%s", timestamp, documentExtension))
 	tempPDF := filepath.Join(tempDir, fmt.Sprintf("invoice_%d.pdf", timestamp))
 
 	// Clean up temporary files
@@ -106,7 +119,7 @@ func (s *Server) renderInvoiceHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Convert ODT to PDF
-	if err := invoicerenderer.ConvertODTToPDF(tempODT, tempPDF); err != nil {
+	if err := s.Converter.Convert(r.Context(), tempODT, tempPDF, godtemplate.FormatPDF); err != nil {
 		s.Logger.Errorf("Failed to convert ODT to PDF: %v", err)
 		http.Error(w, fmt.Sprintf("Failed to convert to PDF: %v", err), http.StatusInternalServerError)
 		return
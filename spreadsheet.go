@@ -0,0 +1,561 @@
+package godtemplate
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/beevik/etree"
+)
+
+// formulaReferencePattern matches the references of OpenFormula expressions,
+// e.g. [.D2], [.D2:.D9] or [$Costs.$A$1]
+var formulaReferencePattern = regexp.MustCompile(`\[([^\[\]]+)\]`)
+
+// cellAddressPattern matches one cell of a cell range address, e.g. .D2,
+// $Sheet1.$D$2 or 'My Sheet'.D2
+var cellAddressPattern = regexp.MustCompile(`^(\$?(?:'(?:[^']|'')*'|[^.']*))\.(\$?[A-Za-z]+)(\$?)([0-9]+)$`)
+
+// formulaAttributes contain OpenFormula expressions with references in
+// brackets.
+var formulaAttributes = []string{"table:formula", "table:expression"}
+
+// addressAttributes contain space separated cell range addresses qualified
+// with their sheet.
+var addressAttributes = []string{"table:cell-range-address", "table:target-range-address", "table:print-ranges", "table:base-cell-address"}
+
+// cachedResultAttributes hold the last calculated result of a formula cell.
+var cachedResultAttributes = []string{"office:value", "office:date-value", "office:time-value", "office:boolean-value", "office:string-value"}
+
+// maxSheetRows is the number of rows of a LibreOffice Calc sheet.
+const maxSheetRows = 1048576
+
+// sheetArea is the part of a sheet filled by FillSheet.
+type sheetArea struct {
+	table *etree.Element
+	sheet string
+	// firstColumn is the index of the first column of a named range.
+	firstColumn int
+	// first and last are the 1-based rows of a named range or the whole
+	// sheet.
+	first, last int
+}
+
+// rowEdit replaces the rows first to first+removed-1 of a sheet by inserted
+// rows.
+type rowEdit struct {
+	sheet                    string
+	first, removed, inserted int
+}
+
+// mapRow returns the new number of a row referenced in a range. A range
+// starting or ending within the replaced rows covers all inserted rows.
+func (e rowEdit) mapRow(row int, end bool) int {
+	switch {
+	case row < e.first:
+		return row
+	case row >= e.first+e.removed:
+		return row + e.inserted - e.removed
+	case end:
+		return e.first + e.inserted - 1
+	default:
+		return e.first
+	}
+}
+
+// FillSheets fills all given sheets or named ranges of a spreadsheet.
+func (r *Replacer) FillSheets(doc *etree.Document, sheets []TableData) error {
+	for _, sheet := range sheets {
+		if err := r.FillSheet(doc, sheet); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// FillSheet fills a sheet or named range of a spreadsheet (.ods) with rows of
+// typed values. Like FillTable, a prototype row with $row.<key> placeholders
+// (optionally several with $rowstyle:<name> markers) is cloned for every
+// entry of Rows. Without prototype row, data.Name must be a named range whose
+// first row is the template row; the values of Columns are written into its
+// cells, starting at the first column of the range. If there are no rows, one
+// empty row is kept.
+//
+// References to the filled rows in formulas, named ranges, database ranges
+// and print ranges are adjusted: ranges covering the prototype or template
+// rows cover all filled rows, e.g. of:=SUM([.D2:.D2]) becomes
+// of:=SUM([.D2:.D11]) for ten rows, and rows below are shifted. Relative
+// references in formulas of the cloned rows move with the row, as if the row
+// was copied in the spreadsheet. The cached results of all formulas are
+// removed, so they are calculated when the document is opened.
+func (r *Replacer) FillSheet(doc *etree.Document, data TableData) error {
+	area, err := findSheetArea(doc, data.Name)
+	if err != nil {
+		return err
+	}
+
+	format := data.formatter()
+
+	prototypes := []*etree.Element{}
+	for _, row := range r.FindPrototypeRows(area.table, "row") {
+		if number := sheetRowNumber(area.table, row); number >= area.first && number <= area.last {
+			prototypes = append(prototypes, row)
+		}
+	}
+
+	if len(prototypes) > 0 {
+		err = r.fillSheetPrototypes(doc, area, prototypes, data, format)
+	} else {
+		err = r.fillSheetColumns(doc, area, data, format)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to fill sheet %s: %w", data.Name, err)
+	}
+
+	clearCachedResults(doc)
+	return nil
+}
+
+func (r *Replacer) fillSheetPrototypes(doc *etree.Document, area *sheetArea, prototypes []*etree.Element, data TableData, format func(any, string) (string, error)) error {
+	styles, err := r.GetRowStyles(prototypes)
+	if err != nil {
+		return err
+	}
+
+	numbers := map[*etree.Element]int{}
+	for _, prototype := range prototypes {
+		numbers[prototype] = sheetRowNumber(area.table, prototype)
+	}
+	first := numbers[prototypes[0]]
+	last := numbers[prototypes[len(prototypes)-1]]
+	if last-first+1 != len(prototypes) {
+		return fmt.Errorf("prototype rows must be adjacent")
+	}
+
+	edit := rowEdit{sheet: area.sheet, first: first, removed: len(prototypes), inserted: max(len(data.Rows), 1)}
+	adjustReferences(doc, edit, prototypes)
+
+	insert := func(index int, prototype *etree.Element, values RowValues) error {
+		row, err := r.InsertPrototypeRowBefore(prototype, styles.First(), "row", values)
+		if err != nil {
+			return err
+		}
+		adjustCopiedRow(row, edit, numbers[prototype], first+index)
+		return nil
+	}
+
+	for i, row := range data.Rows {
+		value, _ := lookupValue(row, "rowstyle")
+		style, _ := value.(string)
+		prototype, err := styles.Select(style, i)
+		if err != nil {
+			return err
+		}
+		err = insert(i, prototype, func(key, valueFormat string) (CellValue, error) {
+			value, _ := lookupValue(row, key)
+			return cellValueOf(value, valueFormat, data.Currency, format)
+		})
+		if err != nil {
+			return err
+		}
+	}
+	if len(data.Rows) == 0 {
+		prototype, err := styles.Select("", 0)
+		if err != nil {
+			return err
+		}
+		err = insert(0, prototype, func(string, string) (CellValue, error) {
+			return CellValue{}, nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	r.RemoveRowStyles(styles)
+	trimTrailingRows(area.table, edit.inserted-edit.removed)
+	return nil
+}
+
+func (r *Replacer) fillSheetColumns(doc *etree.Document, area *sheetArea, data TableData, format func(any, string) (string, error)) error {
+	if area.first == 1 && area.last == maxSheetRows {
+		return fmt.Errorf("sheet has no prototype row; use $row.<key> placeholders or a named range")
+	}
+	if len(data.Columns) == 0 {
+		return fmt.Errorf("named range has no prototype row and no columns are given")
+	}
+
+	template := sheetRowAt(area.table, area.first)
+	if template == nil {
+		return fmt.Errorf("row %d not found", area.first)
+	}
+
+	edit := rowEdit{sheet: area.sheet, first: area.first, removed: 1, inserted: max(len(data.Rows), 1)}
+	adjustReferences(doc, edit, []*etree.Element{template})
+
+	rows := data.Rows
+	if len(rows) == 0 {
+		rows = []map[string]any{{}}
+	}
+	rich := false
+	for i, entry := range rows {
+		row := template.Copy()
+		cells := sheetCells(row, area.firstColumn+len(data.Columns))
+		for j, column := range data.Columns {
+			key, valueFormat, _ := strings.Cut(column, ":")
+			value, _ := lookupValue(entry, key)
+			cell, err := cellValueOf(value, valueFormat, data.Currency, format)
+			if err != nil {
+				return err
+			}
+			fillSheetCell(cells[area.firstColumn+j], cell)
+			rich = rich || cell.Rich
+		}
+		template.Parent().InsertChildAt(template.Index(), row)
+		adjustCopiedRow(row, edit, area.first, area.first+i)
+	}
+	if rich {
+		if err := FinishRichText(template); err != nil {
+			return err
+		}
+	}
+
+	r.RemoveRow(template)
+	trimTrailingRows(area.table, edit.inserted-edit.removed)
+	return nil
+}
+
+// findSheetArea returns the named range or sheet called name.
+func findSheetArea(doc *etree.Document, name string) (*sheetArea, error) {
+	spreadsheet := doc.Root().FindElement("office:body/office:spreadsheet")
+	if spreadsheet == nil {
+		return nil, fmt.Errorf("document is not a spreadsheet")
+	}
+
+	for _, namedRange := range spreadsheet.FindElements(".//table:named-range") {
+		if namedRange.SelectAttrValue("table:name", "") != name {
+			continue
+		}
+		address := namedRange.SelectAttrValue("table:cell-range-address", "")
+		parts := splitAddress(address)
+		start := cellAddressPattern.FindStringSubmatch(parts[0])
+		end := cellAddressPattern.FindStringSubmatch(parts[len(parts)-1])
+		if start == nil || end == nil || start[1] == "" {
+			return nil, fmt.Errorf("unsupported address %s of named range %s", address, name)
+		}
+
+		sheet := sheetName(start[1])
+		table := findSheet(spreadsheet, sheet)
+		if table == nil {
+			return nil, fmt.Errorf("sheet %s of named range %s not found", sheet, name)
+		}
+		first, _ := strconv.Atoi(start[4])
+		last, _ := strconv.Atoi(end[4])
+		return &sheetArea{
+			table:       table,
+			sheet:       sheet,
+			firstColumn: columnIndex(strings.TrimPrefix(start[2], "$")),
+			first:       first,
+			last:        last,
+		}, nil
+	}
+
+	if table := findSheet(spreadsheet, name); table != nil {
+		return &sheetArea{table: table, sheet: name, first: 1, last: maxSheetRows}, nil
+	}
+	return nil, fmt.Errorf("sheet or named range %s not found", name)
+}
+
+func findSheet(spreadsheet *etree.Element, name string) *etree.Element {
+	for _, table := range spreadsheet.SelectElements("table:table") {
+		if table.SelectAttrValue("table:name", "") == name {
+			return table
+		}
+	}
+	return nil
+}
+
+// sheetName returns the name of a sheet in an address without $ and quotes.
+func sheetName(reference string) string {
+	name := strings.TrimPrefix(reference, "$")
+	if strings.HasPrefix(name, "'") && strings.HasSuffix(name, "'") && len(name) > 1 {
+		name = strings.ReplaceAll(name[1:len(name)-1], "''", "'")
+	}
+	return name
+}
+
+// columnIndex returns the 0-based index of a column like "A" or "AB".
+func columnIndex(column string) int {
+	index := 0
+	for _, c := range strings.ToUpper(column) {
+		index = index*26 + int(c-'A') + 1
+	}
+	return index - 1
+}
+
+// splitAddress splits a cell range address at the colon outside of quoted
+// sheet names.
+func splitAddress(address string) []string {
+	parts := []string{}
+	quoted := false
+	start := 0
+	for i, c := range address {
+		switch {
+		case c == '\'':
+			quoted = !quoted
+		case c == ':' && !quoted:
+			parts = append(parts, address[start:i])
+			start = i + 1
+		}
+	}
+	return append(parts, address[start:])
+}
+
+// adjustAddress sets the rows of a cell or cell range address to the result
+// of row. sheet is the sheet of addresses without sheet name.
+func adjustAddress(address, sheet string, row func(sheet string, row int, absolute, end bool) int) string {
+	parts := splitAddress(address)
+	if len(parts) > 2 {
+		return address
+	}
+	for i, part := range parts {
+		m := cellAddressPattern.FindStringSubmatch(part)
+		if m == nil {
+			// whole columns or rows, names, ...
+			return address
+		}
+		if m[1] != "" {
+			sheet = sheetName(m[1])
+		}
+		number, _ := strconv.Atoi(m[4])
+		parts[i] = m[1] + "." + m[2] + m[3] + strconv.Itoa(row(sheet, number, m[3] == "$", i == 1))
+	}
+	return strings.Join(parts, ":")
+}
+
+// adjustReferences applies a row edit to all references of the document,
+// except those in the rows skipped.
+func adjustReferences(doc *etree.Document, edit rowEdit, skipped []*etree.Element) {
+	skip := map[*etree.Element]bool{}
+	for _, row := range skipped {
+		skip[row] = true
+	}
+	row := func(sheet string, row int, absolute, end bool) int {
+		if sheet != edit.sheet {
+			return row
+		}
+		return edit.mapRow(row, end)
+	}
+
+	for _, e := range doc.Root().FindElements(".//*") {
+		if len(e.Attr) == 0 || insideAny(e, skip) {
+			continue
+		}
+		adjustElementReferences(e, row)
+	}
+}
+
+// adjustCopiedRow adjusts the references of a row copied from the row with
+// the number from to the row with the number to. Relative references keep
+// their distance to the row, absolute references follow the edit.
+func adjustCopiedRow(copied *etree.Element, edit rowEdit, from, to int) {
+	row := func(sheet string, row int, absolute, end bool) int {
+		if sheet != edit.sheet {
+			if absolute {
+				return row
+			}
+			return row + to - from
+		}
+		if absolute {
+			return edit.mapRow(row, end)
+		}
+		if row >= edit.first+edit.removed {
+			row += edit.inserted - edit.removed
+		}
+		return row + to - from
+	}
+
+	for _, e := range append([]*etree.Element{copied}, copied.FindElements(".//*")...) {
+		adjustElementReferences(e, row)
+	}
+}
+
+// adjustElementReferences adjusts the references in the formula and address
+// attributes of e.
+func adjustElementReferences(e *etree.Element, row func(sheet string, row int, absolute, end bool) int) {
+	sheet := ""
+	for _, key := range formulaAttributes {
+		attr := e.SelectAttr(key)
+		if attr == nil {
+			continue
+		}
+		if sheet == "" {
+			sheet = sheetOf(e)
+		}
+		attr.Value = formulaReferencePattern.ReplaceAllStringFunc(attr.Value, func(reference string) string {
+			return "[" + adjustAddress(reference[1:len(reference)-1], sheet, row) + "]"
+		})
+	}
+	for _, key := range addressAttributes {
+		attr := e.SelectAttr(key)
+		if attr == nil {
+			continue
+		}
+		addresses := strings.Fields(attr.Value)
+		for i, address := range addresses {
+			addresses[i] = adjustAddress(address, "", row)
+		}
+		attr.Value = strings.Join(addresses, " ")
+	}
+}
+
+// sheetOf returns the name of the sheet containing e.
+func sheetOf(e *etree.Element) string {
+	for ; e != nil; e = e.Parent() {
+		if e.FullTag() == "table:table" {
+			return e.SelectAttrValue("table:name", "")
+		}
+	}
+	return ""
+}
+
+func insideAny(e *etree.Element, elements map[*etree.Element]bool) bool {
+	for ; e != nil; e = e.Parent() {
+		if elements[e] {
+			return true
+		}
+	}
+	return false
+}
+
+// sheetRowNumber returns the 1-based number of a row of a sheet.
+func sheetRowNumber(table, row *etree.Element) int {
+	number := 1
+	for _, r := range tableRows(table) {
+		if r == row {
+			return number
+		}
+		number += repeatCount(r, "table:number-rows-repeated")
+	}
+	return 0
+}
+
+// sheetRowAt returns the row with the 1-based number of a sheet. A row
+// repeated with table:number-rows-repeated is split, so the returned row is
+// not repeated.
+func sheetRowAt(table *etree.Element, number int) *etree.Element {
+	start := 1
+	for _, row := range tableRows(table) {
+		repeat := repeatCount(row, "table:number-rows-repeated")
+		if number >= start+repeat {
+			start += repeat
+			continue
+		}
+		return splitRepeated(row, "table:number-rows-repeated", number-start, repeat)
+	}
+	return nil
+}
+
+// sheetCells returns the first count cells of a row, splitting cells
+// repeated with table:number-columns-repeated.
+func sheetCells(row *etree.Element, count int) []*etree.Element {
+	cells := []*etree.Element{}
+	for len(cells) < count {
+		var next *etree.Element
+		for _, cell := range row.ChildElements()[len(cells):] {
+			if cell.FullTag() == "table:table-cell" || cell.FullTag() == "table:covered-table-cell" {
+				next = cell
+				break
+			}
+		}
+		if next == nil {
+			next = row.CreateElement("table:table-cell")
+		}
+		cells = append(cells, splitRepeated(next, "table:number-columns-repeated", 0, repeatCount(next, "table:number-columns-repeated")))
+	}
+	return cells
+}
+
+// splitRepeated splits an element repeated by the attribute into the
+// repetitions before the one with the index, that one and the ones after it,
+// and returns the single element.
+func splitRepeated(e *etree.Element, attribute string, index, repeat int) *etree.Element {
+	if repeat <= 1 {
+		return e
+	}
+	parent := e.Parent()
+	position := e.Index()
+
+	if index > 0 {
+		before := e.Copy()
+		before.CreateAttr(attribute, strconv.Itoa(index))
+		parent.InsertChildAt(position, before)
+		position++
+	}
+	single := e.Copy()
+	single.RemoveAttr(attribute)
+	parent.InsertChildAt(position, single)
+
+	if after := repeat - index - 1; after > 1 {
+		e.CreateAttr(attribute, strconv.Itoa(after))
+	} else if after == 1 {
+		e.RemoveAttr(attribute)
+	} else {
+		parent.RemoveChild(e)
+	}
+	return single
+}
+
+func repeatCount(e *etree.Element, attribute string) int {
+	count, err := strconv.Atoi(e.SelectAttrValue(attribute, "1"))
+	if err != nil || count < 1 {
+		return 1
+	}
+	return count
+}
+
+// trimTrailingRows removes added rows from the repeated empty rows at the end
+// of a sheet, so it does not exceed the maximum number of rows.
+func trimTrailingRows(table *etree.Element, added int) {
+	rows := tableRows(table)
+	if added <= 0 || len(rows) == 0 {
+		return
+	}
+	last := rows[len(rows)-1]
+	repeat := repeatCount(last, "table:number-rows-repeated")
+	if repeat > added && ElementText(last) == "" {
+		last.CreateAttr("table:number-rows-repeated", strconv.Itoa(repeat-added))
+	}
+}
+
+// fillSheetCell writes a value into a cell; an empty value leaves the cell
+// empty.
+func fillSheetCell(cell *etree.Element, value CellValue) {
+	if value.Text != "" || value.Value != "" {
+		fillCell(cell, value)
+		return
+	}
+	for len(cell.Child) > 0 {
+		cell.RemoveChildAt(0)
+	}
+	for _, attribute := range valueAttributes {
+		cell.RemoveAttr(attribute)
+	}
+	cell.RemoveAttr("office:currency")
+	cell.RemoveAttr("office:value-type")
+	cell.RemoveAttr("calcext:value-type")
+}
+
+// clearCachedResults removes the results of all formula cells, so they are
+// calculated when the document is opened.
+func clearCachedResults(doc *etree.Document) {
+	for _, cell := range doc.FindElements("//table:table-cell[@table:formula]") {
+		for _, attribute := range cachedResultAttributes {
+			cell.RemoveAttr(attribute)
+		}
+		for _, p := range cell.SelectElements("text:p") {
+			cell.RemoveChild(p)
+		}
+	}
+}
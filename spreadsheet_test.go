@@ -0,0 +1,85 @@
+package godtemplate
+
+import (
+	"testing"
+
+	"github.com/beevik/etree"
+)
+
+func TestRowEditMapRow(t *testing.T) {
+	// row 2 is replaced by ten rows
+	edit := rowEdit{sheet: "Sheet1", first: 2, removed: 1, inserted: 10}
+	tests := []struct {
+		row  int
+		end  bool
+		want int
+	}{
+		{1, false, 1},
+		{2, false, 2},
+		{2, true, 11},
+		{3, false, 12},
+		{5, true, 14},
+	}
+	for _, test := range tests {
+		if got := edit.mapRow(test.row, test.end); got != test.want {
+			t.Errorf("mapRow(%d, %t) = %d, want %d", test.row, test.end, got, test.want)
+		}
+	}
+}
+
+func TestAdjustReferences(t *testing.T) {
+	doc := etree.NewDocument()
+	err := doc.ReadFromString(`<office:document-content><office:body><office:spreadsheet>
+<table:table table:name="Sheet1">
+<table:table-row><table:table-cell table:formula="of:=SUM([.D2:.D2])"/></table:table-row>
+<table:table-row><table:table-cell table:formula="of:=[.D5]*[$Rates.B2]+['Other''s'.A2]"/></table:table-row>
+</table:table>
+</office:spreadsheet>
+<table:named-expressions><table:named-range table:name="Items" table:cell-range-address="$Sheet1.$A$2:.$D$2" table:base-cell-address="$Sheet1.$A$1"/></table:named-expressions>
+</office:body></office:document-content>`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	adjustReferences(doc, rowEdit{sheet: "Sheet1", first: 2, removed: 1, inserted: 10}, nil)
+
+	cells := doc.FindElements("//table:table-cell")
+	if got, want := cells[0].SelectAttrValue("table:formula", ""), "of:=SUM([.D2:.D11])"; got != want {
+		t.Errorf("formula = %q, want %q", got, want)
+	}
+	if got, want := cells[1].SelectAttrValue("table:formula", ""), "of:=[.D14]*[$Rates.B2]+['Other''s'.A2]"; got != want {
+		t.Errorf("formula = %q, want %q", got, want)
+	}
+	namedRange := doc.FindElement("//table:named-range")
+	if got, want := namedRange.SelectAttrValue("table:cell-range-address", ""), "$Sheet1.$A$2:.$D$11"; got != want {
+		t.Errorf("range = %q, want %q", got, want)
+	}
+	if got, want := namedRange.SelectAttrValue("table:base-cell-address", ""), "$Sheet1.$A$1"; got != want {
+		t.Errorf("base cell = %q, want %q", got, want)
+	}
+}
+
+func TestAdjustCopiedRow(t *testing.T) {
+	row := etree.NewElement("table:table-row")
+	cell := row.CreateElement("table:table-cell")
+	cell.CreateAttr("table:formula", "of:=[.B2]*[.C2]+[.$E$5]+[Rates.B2]")
+	table := etree.NewElement("table:table")
+	table.CreateAttr("table:name", "Sheet1")
+	table.AddChild(row)
+
+	// the prototype in row 2 is copied to row 4 of ten inserted rows
+	adjustCopiedRow(row, rowEdit{sheet: "Sheet1", first: 2, removed: 1, inserted: 10}, 2, 4)
+
+	if got, want := cell.SelectAttrValue("table:formula", ""), "of:=[.B4]*[.C4]+[.$E$14]+[Rates.B4]"; got != want {
+		t.Errorf("formula = %q, want %q", got, want)
+	}
+}
+
+func TestAdjustAddressKeepsWholeColumns(t *testing.T) {
+	row := func(sheet string, row int, absolute, end bool) int { return row + 1 }
+	for _, address := range []string{".A:.A", "$Sheet1.1:.2", "Items"} {
+		if got := adjustAddress(address, "Sheet1", row); got != address {
+			t.Errorf("adjustAddress(%q) = %q, want it unchanged", address, got)
+		}
+	}
+}
@@ -0,0 +1,322 @@
+package godtemplate
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/beevik/etree"
+)
+
+// TableData is the content of a named table of the template.
+//
+// If the table contains a prototype row with $row.<key> placeholders, the row
+// is cloned for every entry of Rows and then removed. Several prototype rows
+// are told apart by $rowstyle:<name> markers; a row selects one by its
+// "rowstyle" value, otherwise odd and even rows alternate (see RowStyles).
+//
+// Otherwise one row per entry is filled with the values of Columns into a
+// copy of the first of the last BackupRows rows of the table, which are
+// reinserted after the new rows. If BackupRows is 0, the last row of the
+// table is the template row and is removed. Tables of Word documents are
+// named by their title (alternative text) and filled with text only.
+type TableData struct {
+	Name       string
+	Columns    []string
+	Rows       []map[string]any
+	BackupRows int
+	// Currency is the ISO 4217 code of values with the format "amount" or
+	// "currency". If empty, they are stored as plain numbers.
+	Currency string
+	// Language is the language of values with the format "words" ("en", "de"
+	// or "fr"). If empty, English is used.
+	Language string
+	// Format renders a value for a placeholder like $row.date:date. If nil,
+	// FormatValue is used, with amounts in words in Currency and Language.
+	Format func(value any, format string) (string, error) `json:"-"`
+}
+
+// formatter returns the function rendering the values of the table.
+func (data TableData) formatter() func(any, string) (string, error) {
+	if data.Format != nil {
+		return data.Format
+	}
+	return func(value any, format string) (string, error) {
+		if format == "words" {
+			return formatWords(value, data.Currency, data.Language)
+		}
+		return FormatValue(value, format)
+	}
+}
+
+// FillTables fills all given tables of the document.
+func (r *Replacer) FillTables(doc *etree.Document, tables []TableData) error {
+	for _, table := range tables {
+		if err := r.FillTable(doc, table); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// FillTable fills a single named table of the document with rows.
+func (r *Replacer) FillTable(doc *etree.Document, data TableData) error {
+	table := r.GetTableElement(doc, data.Name)
+	if table == nil {
+		return fmt.Errorf("table %s not found", data.Name)
+	}
+
+	format := data.formatter()
+
+	if prototypes := r.FindPrototypeRows(table, "row"); len(prototypes) > 0 {
+		styles, err := r.GetRowStyles(prototypes)
+		if err != nil {
+			return fmt.Errorf("failed to fill table %s: %w", data.Name, err)
+		}
+		for i, row := range data.Rows {
+			value, _ := lookupValue(row, "rowstyle")
+			style, _ := value.(string)
+			prototype, err := styles.Select(style, i)
+			if err != nil {
+				return fmt.Errorf("failed to fill table %s: %w", data.Name, err)
+			}
+			_, err = r.InsertPrototypeRowBefore(prototype, styles.First(), "row", func(key, valueFormat string) (CellValue, error) {
+				value, _ := lookupValue(row, key)
+				return cellValueOf(value, valueFormat, data.Currency, format)
+			})
+			if err != nil {
+				return fmt.Errorf("failed to fill table %s: %w", data.Name, err)
+			}
+		}
+		r.RemoveRowStyles(styles)
+		return nil
+	}
+
+	if len(data.Columns) == 0 {
+		return fmt.Errorf("table %s has no prototype row and no columns are given", data.Name)
+	}
+
+	backupRows := data.BackupRows
+	if backupRows == 0 {
+		backupRows = 1
+	}
+	lastRows := r.BackupLastXRows(table, backupRows)
+	if len(lastRows) == 0 {
+		return fmt.Errorf("no rows found in table %s", data.Name)
+	}
+	for _, row := range data.Rows {
+		values := make([]CellValue, 0, len(data.Columns))
+		for _, column := range data.Columns {
+			key, valueFormat, _ := strings.Cut(column, ":")
+			value, _ := lookupValue(row, key)
+			cell, err := cellValueOf(value, valueFormat, data.Currency, format)
+			if err != nil {
+				return fmt.Errorf("failed to fill table %s: %w", data.Name, err)
+			}
+			values = append(values, cell)
+		}
+		if _, err := r.TableInsertRow(table, lastRows[0], values); err != nil {
+			return fmt.Errorf("failed to fill table %s: %w", data.Name, err)
+		}
+	}
+
+	if data.BackupRows > 0 {
+		r.ReinsertRows(table, lastRows)
+	} else {
+		r.ReinsertRows(table, lastRows[1:])
+	}
+	return nil
+}
+
+// FormatValue renders a value without locale specific formatting: strings as
+// they are, numbers without trailing zeros and lists one entry per line. The
+// formats "number", "amount" and "currency" (two decimals), "integer" and
+// "percent" are supported, as is "words" (amounts in words in English euros,
+// see AmountInWords); "date" (ISO 8601 dates, stored as date cells) and
+// "markdown" (rich text) leave the value as it is, a time.Time is rendered as
+// ISO 8601 date.
+func FormatValue(value any, format string) (string, error) {
+	if value == nil {
+		return "", nil
+	}
+
+	if t, ok := value.(time.Time); ok && format == "date" {
+		return t.Format("2006-01-02"), nil
+	}
+
+	switch format {
+	case "", "markdown", "date":
+	case "words":
+		return formatWords(value, "", "")
+	case "number", "amount", "currency", "integer", "percent":
+		number, ok := ToFloat(value)
+		if !ok {
+			return "", fmt.Errorf("cannot format %v as %s", value, format)
+		}
+		switch format {
+		case "number", "amount", "currency":
+			return fmt.Sprintf("%.2f", number), nil
+		case "integer":
+			return fmt.Sprintf("%.0f", number), nil
+		default:
+			return fmt.Sprintf("%.2f %%", number), nil
+		}
+	default:
+		return "", fmt.Errorf("unsupported format: %s", format)
+	}
+
+	switch v := value.(type) {
+	case string:
+		return v, nil
+	case []string:
+		return strings.Join(v, "\n"), nil
+	case []any:
+		lines := make([]string, 0, len(v))
+		for _, entry := range v {
+			line, err := FormatValue(entry, "")
+			if err != nil {
+				return "", err
+			}
+			lines = append(lines, line)
+		}
+		return strings.Join(lines, "\n"), nil
+	}
+	if number, ok := ToFloat(value); ok {
+		return strconv.FormatFloat(number, 'f', -1, 64), nil
+	}
+	return fmt.Sprint(value), nil
+}
+
+// formatWords writes a number out as amount in words. An empty language
+// means English.
+func formatWords(value any, currency, language string) (string, error) {
+	number, ok := ToFloat(value)
+	if !ok {
+		return "", fmt.Errorf("cannot format %v as words", value)
+	}
+	if language == "" {
+		language = "en"
+	}
+	return AmountInWords(number, currency, language)
+}
+
+// cellValueOf formats a value as typed cell value.
+func cellValueOf(value any, format, currency string, formatter func(any, string) (string, error)) (CellValue, error) {
+	text, err := formatter(value, format)
+	if err != nil {
+		return CellValue{}, err
+	}
+	return TypedCell(value, format, currency, text), nil
+}
+
+// TypedCell returns a cell displaying text with the value type matching value
+// and its format: "date" as date (if the value is a time.Time or an ISO 8601
+// date, else as string), "percent" as percentage, "amount" and
+// "currency" as currency if a currency is given, other numbers as float and
+// booleans as boolean. Strings without format are string cells, "markdown"
+// values rich text string cells.
+func TypedCell(value any, format, currency, text string) CellValue {
+	cell := CellValue{Text: text, Rich: format == "markdown"}
+	if value == nil || cell.Rich || format == "words" {
+		return cell
+	}
+	if format == "date" {
+		if date, ok := dateValue(value); ok {
+			cell.Value = date
+			cell.Type = "date"
+		}
+		return cell
+	}
+	if b, ok := value.(bool); ok && format == "" {
+		return BooleanCell(b, text)
+	}
+	if _, isString := value.(string); isString && format == "" {
+		return cell
+	}
+
+	number, ok := ToFloat(value)
+	if !ok {
+		return cell
+	}
+	switch {
+	case format == "percent":
+		return PercentageCell(number/100, text)
+	case (format == "amount" || format == "currency") && currency != "":
+		return CurrencyCell(number, currency, text)
+	default:
+		return FloatCell(number, text)
+	}
+}
+
+// dateValue returns the office:date-value of a time.Time or of a string
+// holding an ISO 8601 date or date and time. Other values are no dates.
+func dateValue(value any) (string, bool) {
+	switch v := value.(type) {
+	case time.Time:
+		return v.Format("2006-01-02"), true
+	case string:
+		if _, err := time.Parse("2006-01-02", v); err == nil {
+			return v, true
+		}
+		if t, err := time.Parse(time.RFC3339, v); err == nil {
+			return t.Format("2006-01-02T15:04:05"), true
+		}
+		if _, err := time.Parse("2006-01-02T15:04:05", v); err == nil {
+			return v, true
+		}
+	}
+	return "", false
+}
+
+// lookupValue returns the value of a key, ignoring case.
+func lookupValue(row map[string]any, key string) (any, bool) {
+	if value, ok := row[key]; ok {
+		return value, true
+	}
+	for k, value := range row {
+		if strings.EqualFold(k, key) {
+			return value, true
+		}
+	}
+	return nil, false
+}
+
+// ToFloat converts numbers, json.Number and numeric strings to float64.
+func ToFloat(value any) (float64, bool) {
+	switch v := value.(type) {
+	case float64:
+		return v, true
+	case float32:
+		return float64(v), true
+	case int:
+		return float64(v), true
+	case int8:
+		return float64(v), true
+	case int16:
+		return float64(v), true
+	case int32:
+		return float64(v), true
+	case int64:
+		return float64(v), true
+	case uint:
+		return float64(v), true
+	case uint8:
+		return float64(v), true
+	case uint16:
+		return float64(v), true
+	case uint32:
+		return float64(v), true
+	case uint64:
+		return float64(v), true
+	case json.Number:
+		number, err := v.Float64()
+		return number, err == nil
+	case string:
+		number, err := strconv.ParseFloat(v, 64)
+		return number, err == nil
+	default:
+		return 0, false
+	}
+}
@@ -0,0 +1,39 @@
+package godtemplate
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestToFloat(t *testing.T) {
+	tests := []struct {
+		value any
+		want  float64
+		ok    bool
+	}{
+		{float64(1.5), 1.5, true},
+		{float32(2.5), 2.5, true},
+		{int(-3), -3, true},
+		{int8(-8), -8, true},
+		{int16(-16), -16, true},
+		{int32(-32), -32, true},
+		{int64(-64), -64, true},
+		{uint(1), 1, true},
+		{uint8(8), 8, true},
+		{uint16(16), 16, true},
+		{uint32(32), 32, true},
+		{uint64(64), 64, true},
+		{json.Number("12.75"), 12.75, true},
+		{json.Number("abc"), 0, false},
+		{"19.99", 19.99, true},
+		{"abc", 0, false},
+		{true, 0, false},
+		{nil, 0, false},
+	}
+	for _, test := range tests {
+		got, ok := ToFloat(test.value)
+		if ok != test.ok || got != test.want {
+			t.Errorf("ToFloat(%#v) = %v, %t, want %v, %t", test.value, got, ok, test.want, test.ok)
+		}
+	}
+}
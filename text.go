@@ -0,0 +1,227 @@
+package godtemplate
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/beevik/etree"
+)
+
+// ReplaceText replaces all matches of re in the paragraphs and headings of e,
+// also if a match is split over several spans. The replacement takes the
+// formatting of the span containing the start of the match; line breaks in
+// the replacement are converted to text:line-break elements.
+func ReplaceText(e *etree.Element, re *regexp.Regexp, replace func(match []string) (string, error)) error {
+	paragraphs := []*etree.Element{}
+	if e.FullTag() == "text:p" || e.FullTag() == "text:h" {
+		paragraphs = append(paragraphs, e)
+	}
+	paragraphs = append(paragraphs, e.FindElements(".//text:p")...)
+	paragraphs = append(paragraphs, e.FindElements(".//text:h")...)
+
+	for _, p := range paragraphs {
+		if err := replaceParagraphText(p, re, replace); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func replaceParagraphText(p *etree.Element, re *regexp.Regexp, replace func(match []string) (string, error)) error {
+	nodes := []*etree.CharData{}
+	collectCharData(p, &nodes)
+
+	var sb strings.Builder
+	starts := make([]int, 0, len(nodes))
+	for _, node := range nodes {
+		starts = append(starts, sb.Len())
+		sb.WriteString(node.Data)
+	}
+	text := sb.String()
+
+	matches := re.FindAllStringSubmatchIndex(text, -1)
+	if len(matches) == 0 {
+		return nil
+	}
+
+	changed := map[*etree.CharData]bool{}
+	// replace from the end so the offsets of earlier matches stay valid
+	for i := len(matches) - 1; i >= 0; i-- {
+		m := matches[i]
+		groups := make([]string, 0, len(m)/2)
+		for g := 0; g < len(m); g += 2 {
+			if m[g] < 0 {
+				groups = append(groups, "")
+				continue
+			}
+			groups = append(groups, text[m[g]:m[g+1]])
+		}
+		value, err := replace(groups)
+		if err != nil {
+			return err
+		}
+
+		first := nodeAt(starts, m[0])
+		last := nodeAt(starts, m[1]-1)
+		startOffset := m[0] - starts[first]
+		endOffset := m[1] - starts[last]
+
+		if first == last {
+			data := nodes[first].Data
+			nodes[first].SetData(data[:startOffset] + value + data[endOffset:])
+		} else {
+			nodes[first].SetData(nodes[first].Data[:startOffset] + value)
+			for k := first + 1; k < last; k++ {
+				nodes[k].SetData("")
+			}
+			nodes[last].SetData(nodes[last].Data[endOffset:])
+		}
+		changed[nodes[first]] = true
+	}
+
+	for node := range changed {
+		splitLineBreaks(node)
+	}
+	return nil
+}
+
+// ReplaceTokens works like ReplaceText, but replaces the matches by tokens,
+// e.g. spans, hyperlinks and line breaks of rich text. The tokens are inserted
+// into the span containing the start of the match.
+func ReplaceTokens(e *etree.Element, re *regexp.Regexp, replace func(match []string) ([]etree.Token, error)) error {
+	paragraphs := []*etree.Element{}
+	if e.FullTag() == "text:p" || e.FullTag() == "text:h" {
+		paragraphs = append(paragraphs, e)
+	}
+	paragraphs = append(paragraphs, e.FindElements(".//text:p")...)
+	paragraphs = append(paragraphs, e.FindElements(".//text:h")...)
+
+	for _, p := range paragraphs {
+		if err := replaceParagraphTokens(p, re, replace); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func replaceParagraphTokens(p *etree.Element, re *regexp.Regexp, replace func(match []string) ([]etree.Token, error)) error {
+	nodes := []*etree.CharData{}
+	collectCharData(p, &nodes)
+
+	var sb strings.Builder
+	starts := make([]int, 0, len(nodes))
+	for _, node := range nodes {
+		starts = append(starts, sb.Len())
+		sb.WriteString(node.Data)
+	}
+	text := sb.String()
+
+	matches := re.FindAllStringSubmatchIndex(text, -1)
+	// replace from the end so the offsets of earlier matches stay valid
+	for i := len(matches) - 1; i >= 0; i-- {
+		m := matches[i]
+		groups := make([]string, 0, len(m)/2)
+		for g := 0; g < len(m); g += 2 {
+			if m[g] < 0 {
+				groups = append(groups, "")
+				continue
+			}
+			groups = append(groups, text[m[g]:m[g+1]])
+		}
+		tokens, err := replace(groups)
+		if err != nil {
+			return err
+		}
+
+		first := nodeAt(starts, m[0])
+		last := nodeAt(starts, m[1]-1)
+		startOffset := m[0] - starts[first]
+		endOffset := m[1] - starts[last]
+
+		node := nodes[first]
+		rest := ""
+		if first == last {
+			rest = node.Data[endOffset:]
+		} else {
+			for k := first + 1; k < last; k++ {
+				nodes[k].SetData("")
+			}
+			nodes[last].SetData(nodes[last].Data[endOffset:])
+		}
+		node.SetData(node.Data[:startOffset])
+
+		parent := node.Parent()
+		index := node.Index()
+		for _, token := range tokens {
+			index++
+			parent.InsertChildAt(index, token)
+		}
+		if rest != "" {
+			index++
+			parent.InsertChildAt(index, etree.NewText(rest))
+		}
+	}
+	return nil
+}
+
+// TextTokens converts text into text nodes and text:line-break elements.
+func TextTokens(text string) []etree.Token {
+	tokens := []etree.Token{}
+	for i, line := range strings.Split(text, "\n") {
+		if i > 0 {
+			tokens = append(tokens, etree.NewElement("text:line-break"))
+		}
+		if line != "" {
+			tokens = append(tokens, etree.NewText(line))
+		}
+	}
+	return tokens
+}
+
+// collectCharData collects the text nodes of a paragraph in document order.
+// Anchored frames and annotations are skipped; their paragraphs are handled
+// separately.
+func collectCharData(e *etree.Element, nodes *[]*etree.CharData) {
+	for _, token := range e.Child {
+		switch t := token.(type) {
+		case *etree.CharData:
+			*nodes = append(*nodes, t)
+		case *etree.Element:
+			switch t.FullTag() {
+			case "draw:frame", "office:annotation":
+			default:
+				collectCharData(t, nodes)
+			}
+		}
+	}
+}
+
+// nodeAt returns the index of the node containing the text offset.
+func nodeAt(starts []int, offset int) int {
+	index := 0
+	for i, start := range starts {
+		if start <= offset {
+			index = i
+		}
+	}
+	return index
+}
+
+// splitLineBreaks converts line breaks of a text node into text:line-break
+// elements.
+func splitLineBreaks(node *etree.CharData) {
+	if !strings.Contains(node.Data, "\n") || node.Parent() == nil {
+		return
+	}
+
+	parent := node.Parent()
+	index := node.Index()
+	lines := strings.Split(node.Data, "\n")
+	node.SetData(lines[0])
+	for _, line := range lines[1:] {
+		index++
+		parent.InsertChildAt(index, etree.NewElement("text:line-break"))
+		index++
+		parent.InsertChildAt(index, etree.NewText(line))
+	}
+}
@@ -0,0 +1,228 @@
+package godtemplate
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/beevik/etree"
+)
+
+// translationPattern matches label placeholders like $t:invoice.due_date
+var translationPattern = regexp.MustCompile(`\$t:([A-Za-z0-9_]+(?:[.-][A-Za-z0-9_]+)*)`)
+
+// Catalog holds the translated labels of templates per locale.
+type Catalog struct {
+	// Messages maps locales (e.g. "de", "de-CH") to message keys (e.g.
+	// "invoice.due_date") to labels.
+	Messages map[string]map[string]string
+	// Fallback is the locale used for keys missing in the requested locale
+	// and its language, e.g. "en".
+	Fallback string
+}
+
+// MissingTranslation is a message key without label in a locale.
+type MissingTranslation struct {
+	Locale string
+	Key    string
+	// Fallback is the locale whose label is used instead, or empty if the
+	// key has no label at all.
+	Fallback string
+}
+
+func (m MissingTranslation) String() string {
+	if m.Fallback == "" {
+		return fmt.Sprintf("%s: %s", m.Locale, m.Key)
+	}
+	return fmt.Sprintf("%s: %s (falls back to %s)", m.Locale, m.Key, m.Fallback)
+}
+
+// LoadCatalog reads the message files <locale>.json of dir, e.g. de.json and
+// de-CH.json. A file contains an object of labels; nested objects are joined
+// to dotted keys, so {"invoice": {"due_date": "Due date"}} defines the key
+// invoice.due_date.
+func LoadCatalog(dir, fallback string) (*Catalog, error) {
+	files, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("no message files found in %s", dir)
+	}
+
+	c := &Catalog{Messages: map[string]map[string]string{}, Fallback: fallback}
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		var tree map[string]any
+		if err := json.Unmarshal(data, &tree); err != nil {
+			return nil, fmt.Errorf("failed to parse %s: %w", file, err)
+		}
+		messages := map[string]string{}
+		if err := flattenMessages("", tree, messages); err != nil {
+			return nil, fmt.Errorf("failed to parse %s: %w", file, err)
+		}
+		locale := strings.TrimSuffix(filepath.Base(file), filepath.Ext(file))
+		c.Messages[locale] = messages
+	}
+	return c, nil
+}
+
+func flattenMessages(prefix string, tree map[string]any, messages map[string]string) error {
+	for key, value := range tree {
+		switch v := value.(type) {
+		case string:
+			messages[prefix+key] = v
+		case map[string]any:
+			if err := flattenMessages(prefix+key+".", v, messages); err != nil {
+				return err
+			}
+		default:
+			return fmt.Errorf("label %s%s is not a string", prefix, key)
+		}
+	}
+	return nil
+}
+
+// Lookup returns the label of key for locale. Missing labels are looked up
+// in the language of the locale ("de" for "de-CH"), then in the fallback
+// locale and its language. Locales are matched case-insensitively, and "_"
+// is accepted for "-".
+func (c *Catalog) Lookup(locale, key string) (string, bool) {
+	label, _, ok := c.lookup(locale, key, true)
+	return label, ok
+}
+
+// lookup returns the label of key and the locale it was found in.
+func (c *Catalog) lookup(locale, key string, fallback bool) (string, string, bool) {
+	if c == nil {
+		return "", "", false
+	}
+	candidates := localeChain(locale)
+	if fallback {
+		candidates = append(candidates, localeChain(c.Fallback)...)
+	}
+	for _, candidate := range candidates {
+		for name, messages := range c.Messages {
+			if normalizeLocale(name) != candidate {
+				continue
+			}
+			if label, ok := messages[key]; ok {
+				return label, name, true
+			}
+		}
+	}
+	return "", "", false
+}
+
+// localeChain returns the normalized locale followed by its parent locales,
+// e.g. de-ch and de.
+func localeChain(locale string) []string {
+	chain := []string{}
+	for locale = normalizeLocale(locale); locale != ""; {
+		chain = append(chain, locale)
+		index := strings.LastIndex(locale, "-")
+		if index < 0 {
+			break
+		}
+		locale = locale[:index]
+	}
+	return chain
+}
+
+func normalizeLocale(locale string) string {
+	return strings.ToLower(strings.ReplaceAll(locale, "_", "-"))
+}
+
+// Missing reports the keys without label in every locale of the catalog,
+// sorted by locale and key. Labels of the language of a locale count as
+// translations; labels of the fallback locale do not.
+func (c *Catalog) Missing(keys []string) []MissingTranslation {
+	locales := make([]string, 0, len(c.Messages))
+	for locale := range c.Messages {
+		locales = append(locales, locale)
+	}
+	sort.Strings(locales)
+
+	missing := []MissingTranslation{}
+	for _, locale := range locales {
+		missing = append(missing, c.MissingIn(locale, keys)...)
+	}
+	return missing
+}
+
+// MissingIn reports the keys without label in locale, sorted by key.
+func (c *Catalog) MissingIn(locale string, keys []string) []MissingTranslation {
+	sorted := append([]string{}, keys...)
+	sort.Strings(sorted)
+
+	missing := []MissingTranslation{}
+	for _, key := range sorted {
+		if _, _, ok := c.lookup(locale, key, false); ok {
+			continue
+		}
+		_, fallback, _ := c.lookup(locale, key, true)
+		missing = append(missing, MissingTranslation{Locale: locale, Key: key, Fallback: fallback})
+	}
+	return missing
+}
+
+// TranslationKeys returns the keys of all $t:<key> placeholders in doc,
+// sorted and without duplicates.
+func TranslationKeys(doc *etree.Document) []string {
+	text := ElementText
+	if isDocx(doc) {
+		text = DocxText
+	}
+	found := map[string]bool{}
+	for _, tag := range []string{"//text:p", "//text:h", "//w:p"} {
+		for _, p := range doc.FindElements(tag) {
+			for _, match := range translationPattern.FindAllStringSubmatch(text(p), -1) {
+				found[match[1]] = true
+			}
+		}
+	}
+
+	keys := make([]string, 0, len(found))
+	for key := range found {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// ReplaceTranslations replaces $t:<key> placeholders by the labels of the
+// catalog for locale (see Catalog.Lookup). Labels may contain further
+// placeholders like $DUEDATE. Placeholders without label are kept. The keys
+// not translated into locale are returned.
+func (r *Replacer) ReplaceTranslations(doc *etree.Document, catalog *Catalog, locale string) ([]MissingTranslation, error) {
+	keys := TranslationKeys(doc)
+	if len(keys) == 0 {
+		return nil, nil
+	}
+
+	replace := ReplaceText
+	if isDocx(doc) {
+		replace = replaceDocxText
+	}
+	err := replace(doc.Root(), translationPattern, func(match []string) (string, error) {
+		label, ok := catalog.Lookup(locale, match[1])
+		if !ok {
+			return match[0], nil
+		}
+		return label, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if catalog == nil {
+		return nil, nil
+	}
+	return catalog.MissingIn(locale, keys), nil
+}
@@ -0,0 +1,348 @@
+package godtemplate
+
+import (
+	"fmt"
+	"math"
+	"strings"
+)
+
+// currencyName holds the singular and plural names of the major and minor
+// unit of a currency in one language.
+type currencyName struct {
+	Major, Majors string
+	Minor, Minors string
+}
+
+// currencyNames are the unit names used by AmountInWords per currency and
+// language. A currency without minor unit has empty minor names.
+var currencyNames = map[string]map[string]currencyName{
+	"EUR": {
+		"en": {"euro", "euros", "cent", "cents"},
+		"de": {"Euro", "Euro", "Cent", "Cent"},
+		"fr": {"euro", "euros", "centime", "centimes"},
+	},
+	"USD": {
+		"en": {"dollar", "dollars", "cent", "cents"},
+		"de": {"US-Dollar", "US-Dollar", "Cent", "Cent"},
+		"fr": {"dollar", "dollars", "cent", "cents"},
+	},
+	"CHF": {
+		"en": {"franc", "francs", "centime", "centimes"},
+		"de": {"Franken", "Franken", "Rappen", "Rappen"},
+		"fr": {"franc", "francs", "centime", "centimes"},
+	},
+	"GBP": {
+		"en": {"pound", "pounds", "penny", "pence"},
+		"de": {"Pfund", "Pfund", "Penny", "Pence"},
+		"fr": {"livre sterling", "livres sterling", "penny", "pence"},
+	},
+	"JPY": {
+		"en": {"yen", "yen", "", ""},
+		"de": {"Yen", "Yen", "", ""},
+		"fr": {"yen", "yens", "", ""},
+	},
+}
+
+// numberSpellers spell out non-negative integers per language.
+var numberSpellers = map[string]func(n int64) string{
+	"en": englishNumber,
+	"de": germanNumber,
+	"fr": frenchNumber,
+}
+
+// AmountInWords writes an amount out in words for cheques and invoices, e.g.
+// "one hundred nineteen euros and 00 cents", "einhundertneunzehn Euro und
+// 00 Cent" or "cent dix-neuf euros et 00 centimes". The amount is rounded to
+// the minor unit, which is given in digits. Supported languages are "en",
+// "de" and "fr"; currency is an ISO 4217 code, "EUR" if empty. Currencies
+// without known names use the code and the minor unit as fraction, e.g.
+// "one hundred nineteen SEK and 00/100".
+func AmountInWords(value float64, currency, language string) (string, error) {
+	spell, ok := numberSpellers[language]
+	if !ok {
+		return "", fmt.Errorf("unsupported language for amounts in words: %s", language)
+	}
+	if currency == "" {
+		currency = "EUR"
+	}
+	currency = strings.ToUpper(currency)
+	names, known := currencyNames[currency][language]
+	if !known {
+		names = currencyName{Major: currency, Majors: currency}
+	}
+
+	hasMinor := !known || names.Minor != ""
+	minorUnits := int64(math.Round(math.Abs(value) * 100))
+	major, minor := minorUnits/100, minorUnits%100
+	if !hasMinor {
+		major, minor = int64(math.Round(math.Abs(value))), 0
+	}
+
+	var sb strings.Builder
+	if value < 0 && minorUnits > 0 {
+		sb.WriteString(map[string]string{"en": "minus ", "de": "minus ", "fr": "moins "}[language])
+	}
+
+	switch {
+	case language == "de":
+		// a trailing one before the unit is "ein": "ein Euro", "zwei
+		// Millionen ein Euro", "einhundertein Euro"
+		words := spell(major)
+		if strings.HasSuffix(words, "eins") {
+			words = strings.TrimSuffix(words, "s")
+		}
+		sb.WriteString(words)
+	case language == "fr" && major == 1:
+		sb.WriteString("un")
+	default:
+		sb.WriteString(spell(major))
+	}
+	sb.WriteString(" ")
+	unit := names.Majors
+	if major == 1 || (language == "fr" && major == 0) {
+		unit = names.Major
+	}
+	if language == "fr" && major > 0 && major%1000000 == 0 {
+		// "un million d'euros", "deux millions de francs"
+		if strings.ContainsAny(unit[:1], "aeiouyh") {
+			sb.WriteString("d'")
+		} else {
+			sb.WriteString("de ")
+		}
+	}
+	sb.WriteString(unit)
+
+	if !hasMinor {
+		return sb.String(), nil
+	}
+	sb.WriteString(map[string]string{"en": " and ", "de": " und ", "fr": " et "}[language])
+	if !known {
+		sb.WriteString(fmt.Sprintf("%02d/100", minor))
+		return sb.String(), nil
+	}
+	unit = names.Minors
+	if minor == 1 || (language == "fr" && minor == 0) {
+		unit = names.Minor
+	}
+	sb.WriteString(fmt.Sprintf("%02d %s", minor, unit))
+	return sb.String(), nil
+}
+
+// scale is a power of thousand with its singular and plural name.
+type scale struct {
+	value            int64
+	singular, plural string
+}
+
+var englishOnes = []string{"zero", "one", "two", "three", "four", "five", "six", "seven", "eight", "nine", "ten",
+	"eleven", "twelve", "thirteen", "fourteen", "fifteen", "sixteen", "seventeen", "eighteen", "nineteen"}
+
+var englishTens = []string{"", "", "twenty", "thirty", "forty", "fifty", "sixty", "seventy", "eighty", "ninety"}
+
+var englishScales = []scale{
+	{1000000000000, "trillion", "trillion"},
+	{1000000000, "billion", "billion"},
+	{1000000, "million", "million"},
+	{1000, "thousand", "thousand"},
+}
+
+// englishNumber spells a number in (American) English, e.g. "one hundred
+// twenty-one".
+func englishNumber(n int64) string {
+	if n < 20 {
+		return englishOnes[n]
+	}
+	parts := []string{}
+	for _, s := range englishScales {
+		if n >= s.value {
+			parts = append(parts, englishNumber(n/s.value)+" "+s.singular)
+			n %= s.value
+		}
+	}
+	if n >= 100 {
+		parts = append(parts, englishOnes[n/100]+" hundred")
+		n %= 100
+	}
+	switch {
+	case n == 0:
+	case n < 20:
+		parts = append(parts, englishOnes[n])
+	case n%10 == 0:
+		parts = append(parts, englishTens[n/10])
+	default:
+		parts = append(parts, englishTens[n/10]+"-"+englishOnes[n%10])
+	}
+	return strings.Join(parts, " ")
+}
+
+var germanOnes = []string{"null", "eins", "zwei", "drei", "vier", "fünf", "sechs", "sieben", "acht", "neun", "zehn",
+	"elf", "zwölf", "dreizehn", "vierzehn", "fünfzehn", "sechzehn", "siebzehn", "achtzehn", "neunzehn"}
+
+var germanTens = []string{"", "", "zwanzig", "dreißig", "vierzig", "fünfzig", "sechzig", "siebzig", "achtzig", "neunzig"}
+
+var germanScales = []scale{
+	{1000000000000, "Billion", "Billionen"},
+	{1000000000, "Milliarde", "Milliarden"},
+	{1000000, "Million", "Millionen"},
+}
+
+// germanNumber spells a number in German, e.g. "einhunderteinundzwanzig".
+// Millions and above are separate words: "zwei Millionen dreitausend".
+func germanNumber(n int64) string {
+	if n == 0 {
+		return germanOnes[0]
+	}
+	parts := []string{}
+	for _, s := range germanScales {
+		if n >= s.value {
+			count := n / s.value
+			if count == 1 {
+				parts = append(parts, "eine "+s.singular)
+			} else if words := germanBelowMillion(count); strings.HasSuffix(words, "eins") {
+				// the scales are feminine: "einhunderteine Millionen"
+				parts = append(parts, strings.TrimSuffix(words, "s")+"e "+s.plural)
+			} else {
+				parts = append(parts, words+" "+s.plural)
+			}
+			n %= s.value
+		}
+	}
+	if n > 0 {
+		parts = append(parts, germanBelowMillion(n))
+	}
+	return strings.Join(parts, " ")
+}
+
+func germanBelowMillion(n int64) string {
+	var sb strings.Builder
+	if n >= 1000 {
+		sb.WriteString(germanBelowThousand(n/1000, true) + "tausend")
+		n %= 1000
+	}
+	if n > 0 {
+		sb.WriteString(germanBelowThousand(n, false))
+	}
+	return sb.String()
+}
+
+// germanBelowThousand spells 1 to 999; prefix selects "ein" instead of
+// "eins" for a trailing one, as in "einundzwanzigtausend" or "eintausend".
+func germanBelowThousand(n int64, prefix bool) string {
+	var sb strings.Builder
+	if n >= 100 {
+		sb.WriteString(germanUnit(n/100, true) + "hundert")
+		n %= 100
+	}
+	switch {
+	case n == 0:
+	case n < 20:
+		sb.WriteString(germanUnit(n, prefix))
+	case n%10 == 0:
+		sb.WriteString(germanTens[n/10])
+	default:
+		sb.WriteString(germanUnit(n%10, true) + "und" + germanTens[n/10])
+	}
+	return sb.String()
+}
+
+func germanUnit(n int64, prefix bool) string {
+	if n == 1 && prefix {
+		return "ein"
+	}
+	return germanOnes[n]
+}
+
+var frenchOnes = []string{"zéro", "un", "deux", "trois", "quatre", "cinq", "six", "sept", "huit", "neuf", "dix",
+	"onze", "douze", "treize", "quatorze", "quinze", "seize", "dix-sept", "dix-huit", "dix-neuf"}
+
+var frenchTens = []string{"", "", "vingt", "trente", "quarante", "cinquante", "soixante"}
+
+var frenchScales = []scale{
+	{1000000000000, "billion", "billions"},
+	{1000000000, "milliard", "milliards"},
+	{1000000, "million", "millions"},
+}
+
+// frenchNumber spells a number in French (traditional spelling), e.g. "cent
+// vingt et un", "quatre-vingts" or "deux cent mille".
+func frenchNumber(n int64) string {
+	if n == 0 {
+		return frenchOnes[0]
+	}
+	parts := []string{}
+	for _, s := range frenchScales {
+		if n >= s.value {
+			count := n / s.value
+			if count == 1 {
+				parts = append(parts, "un "+s.singular)
+			} else {
+				parts = append(parts, frenchBelowThousand(count, false)+" "+s.plural)
+			}
+			n %= s.value
+		}
+	}
+	if n >= 1000 {
+		if n/1000 > 1 {
+			parts = append(parts, frenchBelowThousand(n/1000, true)+" mille")
+		} else {
+			parts = append(parts, "mille")
+		}
+		n %= 1000
+	}
+	if n > 0 {
+		parts = append(parts, frenchBelowThousand(n, false))
+	}
+	return strings.Join(parts, " ")
+}
+
+// frenchBelowThousand spells 1 to 999; invariable drops the plural s of
+// "cents" and "quatre-vingts" before "mille".
+func frenchBelowThousand(n int64, invariable bool) string {
+	parts := []string{}
+	if n >= 100 {
+		hundreds := n / 100
+		n %= 100
+		switch {
+		case hundreds == 1:
+			parts = append(parts, "cent")
+		case n == 0 && !invariable:
+			parts = append(parts, frenchOnes[hundreds]+" cents")
+		default:
+			parts = append(parts, frenchOnes[hundreds]+" cent")
+		}
+	}
+	if n > 0 {
+		parts = append(parts, frenchBelowHundred(n, invariable))
+	}
+	return strings.Join(parts, " ")
+}
+
+func frenchBelowHundred(n int64, invariable bool) string {
+	switch {
+	case n < 20:
+		return frenchOnes[n]
+	case n < 70:
+		tens, ones := n/10, n%10
+		switch ones {
+		case 0:
+			return frenchTens[tens]
+		case 1:
+			return frenchTens[tens] + " et un"
+		default:
+			return frenchTens[tens] + "-" + frenchOnes[ones]
+		}
+	case n < 80:
+		if n == 71 {
+			return "soixante et onze"
+		}
+		return "soixante-" + frenchOnes[n-60]
+	default:
+		if n == 80 {
+			if invariable {
+				return "quatre-vingt"
+			}
+			return "quatre-vingts"
+		}
+		return "quatre-vingt-" + frenchOnes[n-80]
+	}
+}
@@ -0,0 +1,52 @@
+package godtemplate
+
+import "testing"
+
+func TestAmountInWords(t *testing.T) {
+	tests := []struct {
+		value    float64
+		currency string
+		language string
+		want     string
+	}{
+		{0, "EUR", "en", "zero euros and 00 cents"},
+		{1, "EUR", "en", "one euro and 00 cents"},
+		{21, "USD", "en", "twenty-one dollars and 00 cents"},
+		{1000001, "EUR", "en", "one million one euros and 00 cents"},
+		{119.99, "EUR", "en", "one hundred nineteen euros and 99 cents"},
+		{-1.01, "GBP", "en", "minus one pound and 01 penny"},
+		{0, "EUR", "de", "null Euro und 00 Cent"},
+		{1, "EUR", "de", "ein Euro und 00 Cent"},
+		{21, "EUR", "de", "einundzwanzig Euro und 00 Cent"},
+		{101, "EUR", "de", "einhundertein Euro und 00 Cent"},
+		{1000001, "EUR", "de", "eine Million ein Euro und 00 Cent"},
+		{2000001.01, "EUR", "de", "zwei Millionen ein Euro und 01 Cent"},
+		{101001000, "EUR", "de", "einhunderteine Millionen eintausend Euro und 00 Cent"},
+		{-21.5, "CHF", "de", "minus einundzwanzig Franken und 50 Rappen"},
+		{0, "EUR", "fr", "zéro euro et 00 centime"},
+		{1, "EUR", "fr", "un euro et 00 centime"},
+		{21, "EUR", "fr", "vingt et un euros et 00 centime"},
+		{1000001, "EUR", "fr", "un million un euros et 00 centime"},
+		{1000000, "EUR", "fr", "un million d'euros et 00 centime"},
+		{80.25, "EUR", "fr", "quatre-vingts euros et 25 centimes"},
+		{-21, "EUR", "fr", "moins vingt et un euros et 00 centime"},
+		{1500, "JPY", "en", "one thousand five hundred yen"},
+		{119, "SEK", "en", "one hundred nineteen SEK and 00/100"},
+	}
+	for _, test := range tests {
+		got, err := AmountInWords(test.value, test.currency, test.language)
+		if err != nil {
+			t.Errorf("AmountInWords(%v, %q, %q): %v", test.value, test.currency, test.language, err)
+			continue
+		}
+		if got != test.want {
+			t.Errorf("AmountInWords(%v, %q, %q) = %q, want %q", test.value, test.currency, test.language, got, test.want)
+		}
+	}
+}
+
+func TestAmountInWordsUnsupportedLanguage(t *testing.T) {
+	if _, err := AmountInWords(1, "EUR", "xx"); err == nil {
+		t.Error("expected an error for an unsupported language")
+	}
+}